@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// defaultAlertWindow is the window of rate rules without one.
+	defaultAlertWindow = time.Minute
+	// alertCooldown is the shortest time between the logs of two firings of a
+	// rule, so that a burst of matching logs doesn't run the command for
+	// each.
+	alertCooldown = time.Second
+	// alertCommandTimeout is how long an alert command can run before it is
+	// killed.
+	alertCommandTimeout = 30 * time.Second
+	// maxAlertHistory is the number of firings kept for the alerts page.
+	maxAlertHistory = 1000
+	// desktopNotifyTimeout is how long a desktop notification command can
+	// run, e.g. when there is no notification server.
+	desktopNotifyTimeout = 5 * time.Second
+)
+
+// desktopNotifiers are the commands showing a desktop notification on each
+// OS, run with the title and body as their last arguments.
+var desktopNotifiers = map[string][]string{
+	"linux": {"notify-send"},
+	"darwin": {
+		"osascript",
+		"-e", "on run argv",
+		"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+		"-e", "end run",
+	},
+}
+
+// alertRuleConfig is an alert rule as written in the config file.
+type alertRuleConfig struct {
+	Name  string `json:"name"`
+	Match string `json:"match"`
+	// Threshold makes a rate rule, firing when more than Threshold logs
+	// match within Window.
+	Threshold int    `json:"threshold"`
+	Window    string `json:"window"`
+	// Command is run by the shell with the JSON of the log on stdin.
+	Command string `json:"command"`
+	// Desktop shows a desktop notification, with notify-send on Linux and
+	// osascript on macOS.
+	Desktop bool `json:"desktop"`
+}
+
+type alertRule struct {
+	name      string
+	condition *condition
+	threshold int
+	window    time.Duration
+	command   string
+	desktop   bool
+	// matches holds the timestamps of the recent matching logs of rate
+	// rules.
+	matches []time.Time
+	// lastFired is the timestamp of the log the rule last fired on. Like
+	// the window, the cooldown follows the log timestamps, so that replayed
+	// logs fire as they did live.
+	lastFired time.Time
+}
+
+// alertFiring records that a rule fired on a log. count is the number of
+// matching logs within the window of rate rules, or 1.
+type alertFiring struct {
+	rule  string
+	fired time.Time
+	count int
+	log   log
+}
+
+// alerter checks logs against alert rules as they are appended.
+type alerter struct {
+	mu      sync.Mutex
+	rules   []*alertRule
+	history []alertFiring
+	// notify is called, without the lock held, each time a rule fires.
+	notify func(alertFiring)
+}
+
+// newAlerter parses the alert rules from the config file.
+func newAlerter(configs []alertRuleConfig) (*alerter, error) {
+	a := alerter{}
+	for i, rc := range configs {
+		c, err := parseCondition(rc.Match)
+		if err != nil {
+			return nil, err
+		}
+		r := alertRule{
+			name:      rc.Name,
+			condition: c,
+			threshold: rc.Threshold,
+			window:    defaultAlertWindow,
+			command:   rc.Command,
+			desktop:   rc.Desktop,
+		}
+		if r.name == "" {
+			r.name = fmt.Sprintf("alert %d", i+1)
+		}
+		if rc.Window != "" {
+			r.window, err = time.ParseDuration(rc.Window)
+			if err != nil || r.window <= 0 {
+				return nil, fmt.Errorf("invalid alert window: \"%s\"", rc.Window)
+			}
+		}
+		a.rules = append(a.rules, &r)
+	}
+	return &a, nil
+}
+
+// check fires the rules matching l.
+func (a *alerter) check(l log) {
+	a.mu.Lock()
+	firings := []alertFiring{}
+	rules := []*alertRule{}
+	now := time.Now()
+	for _, r := range a.rules {
+		if !r.condition.match(&l) {
+			continue
+		}
+		count := 1
+		if r.threshold > 0 {
+			r.matches = append(r.matches, l.timestamp)
+			start := 0
+			for start < len(r.matches) && l.timestamp.Sub(r.matches[start]) >= r.window {
+				start++
+			}
+			r.matches = r.matches[start:]
+			if len(r.matches) <= r.threshold {
+				continue
+			}
+			count = len(r.matches)
+		}
+		if !r.lastFired.IsZero() && absDuration(l.timestamp.Sub(r.lastFired)) < alertCooldown {
+			continue
+		}
+		r.lastFired = l.timestamp
+		r.matches = nil
+
+		f := alertFiring{rule: r.name, fired: now, count: count, log: l}
+		a.history = append(a.history, f)
+		if len(a.history) > maxAlertHistory {
+			a.history = a.history[len(a.history)-maxAlertHistory:]
+		}
+		firings = append(firings, f)
+		rules = append(rules, r)
+	}
+	notify := a.notify
+	a.mu.Unlock()
+
+	for i, f := range firings {
+		slog.Info("alert fired", "rule", f.rule, "count", f.count)
+		if rules[i].command != "" {
+			go runAlertCommand(rules[i].command, f)
+		}
+		if rules[i].desktop {
+			go func(f alertFiring) {
+				err := notifyDesktop(f)
+				if err != nil {
+					slog.Warn("couldn't show desktop notification", "rule", f.rule, "error", err)
+				}
+			}(f)
+		}
+		if notify != nil {
+			notify(f)
+		}
+	}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// setNotify sets the function called each time a rule fires.
+func (a *alerter) setNotify(notify func(alertFiring)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.notify = notify
+}
+
+// firings returns the alert history, oldest first.
+func (a *alerter) firings() []alertFiring {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]alertFiring{}, a.history...)
+}
+
+// runAlertCommand runs command with the shell, with the JSON of the log on
+// stdin and the rule name in LTOP_ALERT. The command is killed after
+// alertCommandTimeout.
+func runAlertCommand(command string, f alertFiring) {
+	logJSON, err := json.Marshal(f.log.data)
+	if err != nil {
+		slog.Error("couldn't encode alert log", "rule", f.rule, "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), alertCommandTimeout)
+	defer cancel()
+	cmd := shellCommand(ctx, command)
+	cmd.Stdin = bytes.NewReader(append(logJSON, '\n'))
+	cmd.Env = append(os.Environ(), "LTOP_ALERT="+f.rule, fmt.Sprintf("LTOP_ALERT_COUNT=%d", f.count))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		slog.Warn("alert command failed", "rule", f.rule, "error", err, "output", string(output))
+	}
+}
+
+// notifyDesktop shows a desktop notification of a firing, titled with the
+// rule name.
+func notifyDesktop(f alertFiring) error {
+	notifier, ok := desktopNotifiers[runtime.GOOS]
+	if !ok {
+		return fmt.Errorf("desktop notifications aren't supported on %s", runtime.GOOS)
+	}
+	path, err := exec.LookPath(notifier[0])
+	if err != nil {
+		return fmt.Errorf("couldn't find %s: %w", notifier[0], err)
+	}
+	body := f.log.message
+	if f.count > 1 {
+		body = fmt.Sprintf("%d matching logs: %s", f.count, body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), desktopNotifyTimeout)
+	defer cancel()
+	args := append(append([]string{}, notifier[1:]...), "ltop: "+f.rule, body)
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.WaitDelay = commandWaitDelay
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("couldn't run %s: %w: %s", notifier[0], err, output)
+	}
+	return nil
+}
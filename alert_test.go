@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAlerterErrors(t *testing.T) {
+	for _, rc := range []alertRuleConfig{
+		{Match: "msg~("},
+		{Match: "level=warn", Threshold: 5, Window: "soon"},
+		{Match: "level=warn", Threshold: 5, Window: "-1m"},
+	} {
+		_, err := newAlerter([]alertRuleConfig{rc})
+		assert.Error(t, err, rc)
+	}
+}
+
+func TestAlerterCheck(t *testing.T) {
+	a, err := newAlerter([]alertRuleConfig{
+		{Match: "level=error && msg~panic"},
+		{Name: "warnings", Match: "level=warn", Threshold: 2, Window: "1m"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	fired := []alertFiring{}
+	a.setNotify(func(f alertFiring) { fired = append(fired, f) })
+
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	a.check(log{severity: severityError, level: "error", message: "all good", timestamp: start})
+	a.check(log{severity: severityError, level: "error", message: "panic: oops", timestamp: start})
+	if assert.Len(t, fired, 1) {
+		assert.Equal(t, "alert 1", fired[0].rule)
+		assert.Equal(t, 1, fired[0].count)
+		assert.Equal(t, "panic: oops", fired[0].log.message)
+	}
+
+	// Only 2 warnings within the window, and the first one expires.
+	a.check(log{severity: severityWarn, level: "warn", timestamp: start})
+	a.check(log{severity: severityWarn, level: "warn", timestamp: start.Add(30 * time.Second)})
+	a.check(log{severity: severityWarn, level: "warn", timestamp: start.Add(70 * time.Second)})
+	assert.Len(t, fired, 1)
+
+	a.check(log{severity: severityWarn, level: "warn", timestamp: start.Add(80 * time.Second)})
+	if assert.Len(t, fired, 2) {
+		assert.Equal(t, "warnings", fired[1].rule)
+		assert.Equal(t, 3, fired[1].count)
+	}
+
+	// The cooldown keeps a burst from firing again.
+	a.check(log{severity: severityError, level: "error", message: "panic again", timestamp: start})
+	assert.Len(t, fired, 2)
+	assert.Len(t, a.firings(), 2)
+
+	// The cooldown follows log timestamps, so replayed logs fire at once.
+	a.check(log{severity: severityError, level: "error", message: "panic later", timestamp: start.Add(2 * time.Second)})
+	if assert.Len(t, fired, 3) {
+		assert.Equal(t, "panic later", fired[2].log.message)
+	}
+}
+
+func TestRunAlertCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alert")
+	runAlertCommand(
+		`printf '%s %s ' "$LTOP_ALERT" "$LTOP_ALERT_COUNT" > `+path+` && cat >> `+path,
+		alertFiring{rule: "panics", count: 3, log: log{data: map[string]any{"msg": "panic"}}},
+	)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "panics 3 {\"msg\":\"panic\"}\n", string(data))
+}
+
+func TestNotifyDesktop(t *testing.T) {
+	sh := testShell(t)
+	defer func(notifier []string) { desktopNotifiers[runtime.GOOS] = notifier }(desktopNotifiers[runtime.GOOS])
+	path := filepath.Join(t.TempDir(), "notification")
+	desktopNotifiers[runtime.GOOS] = []string{sh, "-c", `printf '%s|%s' "$1" "$2" > ` + path, "sh"}
+
+	err := notifyDesktop(alertFiring{rule: "warnings", count: 51, log: log{message: "slow query"}})
+	assert.NoError(t, err)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "ltop: warnings|51 matching logs: slow query", string(data))
+
+	desktopNotifiers[runtime.GOOS] = []string{sh, "-c", "exit 1"}
+	assert.Error(t, notifyDesktop(alertFiring{rule: "panics", count: 1}))
+}
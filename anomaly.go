@@ -0,0 +1,275 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// anomalyAlpha is the weight of each second in the moving average and
+	// variance of a rate.
+	anomalyAlpha = 0.1
+	// anomalyThreshold is the z-score above which a second is a spike.
+	anomalyThreshold = 3.0
+	// anomalyMinCount is the smallest count of logs in a spike second, so
+	// that a few logs after a quiet period aren't spikes.
+	anomalyMinCount = 5
+	// anomalyWarmup is the number of seconds of baseline before spikes are
+	// detected.
+	anomalyWarmup = 10
+	// anomalyMaxGap is the longest period without logs after which the
+	// baseline is reset, e.g. between the files of a replay.
+	anomalyMaxGap = time.Hour
+)
+
+// anomaly is a run of consecutive seconds where a rate is far above its
+// baseline.
+type anomaly struct {
+	// metric is "volume" for all logs, or "errors" for logs with at least
+	// error severity.
+	metric string
+	start  time.Time
+	end    time.Time
+	// peak is the highest count of logs in a second.
+	peak int
+	// baseline is the average count per second before the peak.
+	baseline float64
+	// score is the z-score of the peak.
+	score float64
+}
+
+// detectAnomalies finds the spikes of the volume and error rates, using an
+// exponentially weighted moving average and variance of the counts per
+// second. Anomalies are sorted by start time.
+func detectAnomalies(buckets []rateBucket) []anomaly {
+	detectors := newRateDetectors()
+	for _, b := range buckets {
+		for _, d := range detectors {
+			d.add(b)
+		}
+	}
+	return mergeAnomalies(detectors)
+}
+
+// rateDetector detects the spikes of one rate, from buckets added in order.
+type rateDetector struct {
+	metric    string
+	count     func(rateBucket) int
+	mean      float64
+	variance  float64
+	seconds   int
+	last      time.Time
+	anomalies []anomaly
+}
+
+// newRateDetectors returns the detectors of the volume and error rates.
+func newRateDetectors() []*rateDetector {
+	return []*rateDetector{
+		{metric: "volume", count: func(b rateBucket) int { return b.total }},
+		{metric: "errors", count: func(b rateBucket) int { return b.errors }},
+	}
+}
+
+// clone returns a copy of d that can observe more buckets without changing d.
+func (d *rateDetector) clone() *rateDetector {
+	c := *d
+	c.anomalies = append([]anomaly{}, d.anomalies...)
+	return &c
+}
+
+// mergeAnomalies returns the anomalies of all detectors, sorted by start time.
+func mergeAnomalies(detectors []*rateDetector) []anomaly {
+	anomalies := []anomaly{}
+	for _, d := range detectors {
+		anomalies = append(anomalies, d.anomalies...)
+	}
+	slices.SortStableFunc(anomalies, func(a, b anomaly) bool { return a.start.Before(b.start) })
+	return anomalies
+}
+
+// add observes a bucket, after the previous ones.
+func (d *rateDetector) add(b rateBucket) {
+	if !d.last.IsZero() && b.time.Sub(d.last) > anomalyMaxGap {
+		d.mean, d.variance, d.seconds = 0, 0, 0
+	} else if !d.last.IsZero() {
+		// seconds without logs count as zero
+		for t := d.last.Add(time.Second); t.Before(b.time); t = t.Add(time.Second) {
+			d.observe(t, 0)
+		}
+	}
+	d.observe(b.time, d.count(b))
+	d.last = b.time
+}
+
+func (d *rateDetector) observe(t time.Time, n int) {
+	x := float64(n)
+	if d.seconds >= anomalyWarmup && n >= anomalyMinCount {
+		// the deviation is at least 1 log per second, so that a steady rate
+		// doesn't make every change a spike
+		score := (x - d.mean) / math.Max(math.Sqrt(d.variance), 1)
+		if score >= anomalyThreshold {
+			current := len(d.anomalies) - 1
+			if current >= 0 && d.anomalies[current].end.Add(time.Second).Equal(t) {
+				d.anomalies[current].end = t
+				if n > d.anomalies[current].peak {
+					d.anomalies[current].peak = n
+					d.anomalies[current].score = score
+				}
+			} else {
+				d.anomalies = append(d.anomalies, anomaly{
+					metric:   d.metric,
+					start:    t,
+					end:      t,
+					peak:     n,
+					baseline: d.mean,
+					score:    score,
+				})
+			}
+		}
+	}
+
+	if d.seconds == 0 {
+		d.mean = x
+	} else {
+		diff := x - d.mean
+		d.mean += anomalyAlpha * diff
+		d.variance = (1 - anomalyAlpha) * (d.variance + anomalyAlpha*diff*diff)
+	}
+	d.seconds++
+}
+
+// rateBucket counts the logs of one second.
+type rateBucket struct {
+	time   time.Time
+	total  int
+	errors int
+}
+
+// rateTracker counts the logs of each second as they are appended, so that
+// rates aren't queried from the whole table. Seconds are observed by the
+// anomaly detectors once a later second has logs; a log appended to an
+// observed second restarts the detection.
+type rateTracker struct {
+	mu sync.Mutex
+	// buckets are sorted by time.
+	buckets   []rateBucket
+	detectors []*rateDetector
+	// observed is the number of buckets the detectors have observed.
+	observed int
+}
+
+func newRateTracker() *rateTracker {
+	return &rateTracker{detectors: newRateDetectors()}
+}
+
+// add counts a log with the given timestamp.
+func (rt *rateTracker) add(timestamp time.Time, isError bool) {
+	second := time.Unix(timestamp.Unix(), 0).UTC()
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	// logs are mostly appended in order
+	i := len(rt.buckets)
+	if i == 0 || rt.buckets[i-1].time.Before(second) {
+		rt.buckets = append(rt.buckets, rateBucket{time: second})
+	} else {
+		i = sort.Search(len(rt.buckets), func(i int) bool { return !rt.buckets[i].time.Before(second) })
+		if i == len(rt.buckets) || !rt.buckets[i].time.Equal(second) {
+			rt.buckets = slices.Insert(rt.buckets, i, rateBucket{time: second})
+		}
+		if i < rt.observed {
+			rt.detectors = newRateDetectors()
+			rt.observed = 0
+		}
+	}
+	rt.buckets[i].total++
+	if isError {
+		rt.buckets[i].errors++
+	}
+}
+
+// recent returns the buckets of the width seconds up to the last bucket.
+func (rt *rateTracker) recent(width int) []rateBucket {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if len(rt.buckets) == 0 {
+		return nil
+	}
+	start := rt.buckets[len(rt.buckets)-1].time.Add(-time.Duration(width-1) * time.Second)
+	i := sort.Search(len(rt.buckets), func(i int) bool { return !rt.buckets[i].time.Before(start) })
+	return append([]rateBucket{}, rt.buckets[i:]...)
+}
+
+// anomalies returns the anomalies of the volume and error rates, sorted by
+// start time. The last second, which may still get logs, is observed by
+// copies of the detectors.
+func (rt *rateTracker) anomalies() []anomaly {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if len(rt.buckets) == 0 {
+		return []anomaly{}
+	}
+
+	for ; rt.observed < len(rt.buckets)-1; rt.observed++ {
+		for _, d := range rt.detectors {
+			d.add(rt.buckets[rt.observed])
+		}
+	}
+	detectors := make([]*rateDetector, 0, len(rt.detectors))
+	for _, d := range rt.detectors {
+		d = d.clone()
+		d.add(rt.buckets[len(rt.buckets)-1])
+		detectors = append(detectors, d)
+	}
+	return mergeAnomalies(detectors)
+}
+
+// sparkBlocks are the characters of a sparkline, from lowest to highest.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// rateSparkline draws the log counts of the width seconds up to end. Seconds
+// within an anomaly are wrapped in spikeTag, a tview color tag.
+func rateSparkline(buckets []rateBucket, anomalies []anomaly, end time.Time, width int, spikeTag string) string {
+	counts := make([]int, width)
+	start := end.Add(-time.Duration(width-1) * time.Second)
+	highest := 0
+	for _, b := range buckets {
+		if b.time.Before(start) || b.time.After(end) {
+			continue
+		}
+		i := int(b.time.Sub(start) / time.Second)
+		counts[i] = b.total
+		if b.total > highest {
+			highest = b.total
+		}
+	}
+
+	builder := strings.Builder{}
+	for i, n := range counts {
+		block := sparkBlocks[0]
+		if highest > 0 {
+			block = sparkBlocks[n*(len(sparkBlocks)-1)/highest]
+		}
+		t := start.Add(time.Duration(i) * time.Second)
+		if inAnomaly(anomalies, t) {
+			builder.WriteString(spikeTag + string(block) + "[-:-:-]")
+		} else {
+			builder.WriteRune(block)
+		}
+	}
+	return builder.String()
+}
+
+func inAnomaly(anomalies []anomaly, t time.Time) bool {
+	for _, a := range anomalies {
+		if !t.Before(a.start) && !t.After(a.end) {
+			return true
+		}
+	}
+	return false
+}
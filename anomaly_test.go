@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testRates returns one bucket per second starting at start, with the given
+// total and error counts.
+func testRates(start time.Time, totals []int, errors []int) []rateBucket {
+	buckets := []rateBucket{}
+	for i, total := range totals {
+		if total == 0 {
+			continue
+		}
+		b := rateBucket{time: start.Add(time.Duration(i) * time.Second), total: total}
+		if i < len(errors) {
+			b.errors = errors[i]
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	start := time.Date(2023, time.July, 24, 18, 34, 0, 0, time.UTC)
+
+	// a steady rate of 10 logs/s, then a volume spike of 2 seconds and an
+	// error spike
+	totals := []int{}
+	errors := []int{}
+	for i := 0; i < 30; i++ {
+		totals = append(totals, 10+i%3)
+		errors = append(errors, i%2)
+	}
+	totals = append(totals, 80, 95, 11, 10, 12, 10, 11)
+	errors = append(errors, 0, 1, 0, 0, 9, 0, 1)
+
+	anomalies := detectAnomalies(testRates(start, totals, errors))
+	assert.Len(t, anomalies, 2)
+
+	assert.Equal(t, "volume", anomalies[0].metric)
+	assert.Equal(t, start.Add(30*time.Second), anomalies[0].start)
+	assert.Equal(t, start.Add(31*time.Second), anomalies[0].end)
+	assert.Equal(t, 95, anomalies[0].peak)
+	assert.InDelta(t, 11, anomalies[0].baseline, 1)
+	assert.Greater(t, anomalies[0].score, anomalyThreshold)
+
+	assert.Equal(t, "errors", anomalies[1].metric)
+	assert.Equal(t, start.Add(34*time.Second), anomalies[1].start)
+	assert.Equal(t, 9, anomalies[1].peak)
+}
+
+func TestDetectAnomaliesQuiet(t *testing.T) {
+	start := time.Date(2023, time.July, 24, 18, 34, 0, 0, time.UTC)
+
+	// no spikes during warmup, or below the minimum count
+	assert.Empty(t, detectAnomalies(testRates(start, []int{1, 1, 50}, nil)))
+	totals := make([]int, 20)
+	totals[0] = 1
+	totals[19] = 4
+	assert.Empty(t, detectAnomalies(testRates(start, totals, nil)))
+
+	// the baseline is reset after a long gap
+	buckets := testRates(start, []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}, nil)
+	buckets = append(buckets, rateBucket{time: start.Add(2 * anomalyMaxGap), total: 50})
+	assert.Empty(t, detectAnomalies(buckets))
+}
+
+func TestRateSparkline(t *testing.T) {
+	start := time.Date(2023, time.July, 24, 18, 34, 0, 0, time.UTC)
+	buckets := testRates(start, []int{1, 0, 4, 8}, nil)
+	anomalies := []anomaly{{start: start.Add(3 * time.Second), end: start.Add(3 * time.Second)}}
+
+	assert.Equal(t, "▁▁▁▄[red]█[-:-:-]", rateSparkline(buckets, anomalies, start.Add(3*time.Second), 5, "[red]"))
+	assert.Equal(t, "▁▁▁", rateSparkline(nil, nil, start, 3, "[red]"))
+}
+
+func TestRateTracker(t *testing.T) {
+	db := testOpenDatabase(t)
+	start := time.Date(2023, time.July, 24, 18, 34, 0, 0, time.UTC)
+	for i, level := range []string{"info", "error", "fatal", "info"} {
+		// 3 logs in the first second, the last one 2 seconds later
+		ts := start.Add(time.Duration(i) * 300 * time.Millisecond)
+		if i == 3 {
+			ts = start.Add(2*time.Second + 123456789*time.Nanosecond)
+		}
+		logJSON := fmt.Sprintf(`{"timestamp":"%s","level":"%s"}`, ts.Format(time.RFC3339Nano), level)
+		assert.NoError(t, db.appendLog([]byte(logJSON)))
+	}
+
+	assert.Equal(
+		t,
+		[]rateBucket{
+			{time: start, total: 3, errors: 2},
+			{time: start.Add(2 * time.Second), total: 1},
+		},
+		db.rates.recent(5),
+	)
+	assert.Equal(t, []rateBucket{{time: start.Add(2 * time.Second), total: 1}}, db.rates.recent(2))
+}
+
+func TestRateTrackerAnomalies(t *testing.T) {
+	start := time.Date(2023, time.July, 24, 18, 34, 0, 0, time.UTC)
+	rt := newRateTracker()
+	assert.Empty(t, rt.anomalies())
+
+	add := func(second, count int) {
+		for i := 0; i < count; i++ {
+			rt.add(start.Add(time.Duration(second)*time.Second+time.Duration(i)*time.Millisecond), false)
+		}
+	}
+	for i := 0; i < 30; i++ {
+		add(i, 10)
+	}
+	assert.Empty(t, rt.anomalies())
+
+	// the last second is observed while it grows, and again once complete
+	add(30, 80)
+	anomalies := rt.anomalies()
+	if assert.Len(t, anomalies, 1) {
+		assert.Equal(t, 80, anomalies[0].peak)
+	}
+	add(30, 15)
+	add(31, 10)
+	anomalies = rt.anomalies()
+	if assert.Len(t, anomalies, 1) {
+		assert.Equal(t, 95, anomalies[0].peak)
+	}
+
+	// a late log in an observed second restarts the detection
+	add(20, 100)
+	anomalies = rt.anomalies()
+	if assert.Len(t, anomalies, 2) {
+		assert.Equal(t, start.Add(20*time.Second), anomalies[0].start)
+		assert.Equal(t, 110, anomalies[0].peak)
+	}
+	assert.Equal(t, detectAnomalies(rt.recent(100)), anomalies)
+}
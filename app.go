@@ -2,19 +2,99 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
+	"golang.org/x/exp/slices"
 	"golang.org/x/exp/slog"
 )
 
 type application struct {
 	*tview.Application
-	pages   *tview.Pages
-	table   *tview.Table
-	content tableContent
-	db      *DB
+	pages     *tview.Pages
+	header    *tview.TextView
+	footer    *tview.TextView
+	table     *tview.Table
+	patterns  *tview.Table
+	anomalies *tview.Table
+	alertList *tview.Table
+	bookmarks *tview.Table
+	context   *tview.Table
+	output    *tview.TextView
+	fields    *tview.Table
+	chart     *tview.TextView
+	input     *tview.InputField
+	content   tableContent
+	db        *DB
+	keymap    *keymap
+	theme     *theme
+	child     *childProcess
+	replay    *replayer
+	alerts    *alerter
+	inputDone <-chan struct{}
+	actions   map[string]func()
+	// pageActions holds the handlers of the actions available in each page
+	// other than main.
+	pageActions map[string]map[string]func()
+	// flashUntil is when the header stops flashing after an alert.
+	flashUntil time.Time
+	// beep rings the terminal bell on the next draw.
+	beep bool
+	// chartField is the last field charted.
+	chartField string
+	// pipeCommand is the last command logs were piped to.
+	pipeCommand string
+	// notice is a message shown in the header until noticeUntil.
+	notice      string
+	noticeUntil time.Time
+	// filter restricts the logs shown in the table, e.g. to a trace.
+	filter *condition
+	// timeRange restricts the logs shown in the table to a period. It is
+	// read by the polling loop.
+	timeRange atomic.Pointer[logRange]
+	// sortField is the field the table is sorted by, if any. It is read by
+	// the polling loop.
+	sortField atomic.Pointer[string]
+	// suspended is true while the pager or editor runs, when the polling
+	// loop must not queue updates that wouldn't be run.
+	suspended atomic.Bool
+	// contextContent holds the logs of the context page, around the log
+	// with id contextId. contextId and contextSize are only used on the UI
+	// goroutine.
+	contextContent tableContent
+	contextId      int64
+	contextSize    int
+}
+
+// logRange is a period of time, including both ends.
+type logRange struct {
+	from time.Time
+	to   time.Time
+}
+
+// sparklineWidth is the number of seconds in the header sparkline.
+const sparklineWidth = 30
+
+// appOptions holds the user interface settings from the command line and the
+// config file.
+type appOptions struct {
+	timeDisplay timeDisplay
+	keymap      *keymap
+	theme       *theme
+	rules       []highlightRule
+	// child is the monitored command, if any.
+	child *childProcess
+	// replay paces the input, if any.
+	replay *replayer
+	// alerts checks logs against the alert rules, if any.
+	alerts *alerter
+	// inputDone is closed when the input file or standard input is closed.
+	inputDone <-chan struct{}
 }
 
 type tableContent struct {
@@ -22,10 +102,31 @@ type tableContent struct {
 	logs          []log
 	columns       []string
 	selectedLogId int64
+	time          timeDisplay
+	theme         *theme
+	rules         []highlightRule
+	// highlightId is the id of a log shown in bold and underlined, or 0.
+	highlightId int64
 }
 
-func newApplication(db *DB) *tview.Application {
-	app := application{db: db, content: tableContent{selectedLogId: -1}}
+func newApplication(db *DB, opts appOptions) *tview.Application {
+	tview.Styles = opts.theme.styles
+
+	app := application{
+		db: db,
+		content: tableContent{
+			selectedLogId: -1,
+			time:          opts.timeDisplay,
+			theme:         opts.theme,
+			rules:         opts.rules,
+		},
+		keymap:    opts.keymap,
+		theme:     opts.theme,
+		child:     opts.child,
+		replay:    opts.replay,
+		alerts:    opts.alerts,
+		inputDone: opts.inputDone,
+	}
 
 	app.pages = tview.NewPages()
 
@@ -37,19 +138,117 @@ func newApplication(db *DB) *tview.Application {
 	)
 	app.table.SetFixed(1, 2)
 
-	app.pages.AddPage("main", app.table, true, true)
+	app.header = tview.NewTextView().SetDynamicColors(true)
+	app.footer = tview.NewTextView().SetDynamicColors(true)
+	app.footer.SetText(app.keymap.footerText(app.theme))
+
+	mainView := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(app.header, 1, 0, false).
+		AddItem(app.table, 0, 1, true).
+		AddItem(app.footer, 1, 0, false)
+	app.pages.AddPage("main", mainView, true, true)
+
+	help := tview.NewTextView().
+		SetDynamicColors(true).
+		SetText(app.keymap.helpText(app.theme))
+	help.SetBorder(true).SetTitle(" Help - press Esc to close ")
+	app.pages.AddPage("help", modal(help, 72, len(keyActions)+2), true, false)
+
+	app.patterns = tview.NewTable().SetSelectable(true, false).SetFixed(1, 0)
+	app.patterns.SetBorder(true).SetTitle(" Patterns - press Enter to filter, Esc to close ")
+	app.patterns.SetSelectedFunc(func(row, col int) { app.filterTemplate(row) })
+	app.pages.AddPage("patterns", app.patterns, true, false)
+
+	app.anomalies = tview.NewTable().SetSelectable(true, false).SetFixed(1, 0)
+	app.anomalies.SetBorder(true).SetTitle(" Anomalies - press Enter to show the logs around a spike, Esc to close ")
+	app.anomalies.SetSelectedFunc(func(row, col int) { app.jumpToAnomaly(row) })
+	app.pages.AddPage("anomalies", app.anomalies, true, false)
+
+	app.alertList = tview.NewTable().SetSelectable(true, false).SetFixed(1, 0)
+	app.alertList.SetBorder(true).SetTitle(" Alerts - press Esc to close ")
+	app.pages.AddPage("alerts", app.alertList, true, false)
+
+	app.bookmarks = tview.NewTable().SetSelectable(true, false).SetFixed(1, 0)
+	app.bookmarks.SetBorder(true).SetTitle(" Bookmarks - press Enter to show a log, Esc to close ")
+	app.bookmarks.SetSelectedFunc(func(row, col int) { app.jumpToBookmark(row) })
+	app.pages.AddPage("bookmarks", app.bookmarks, true, false)
+
+	app.contextContent = tableContent{
+		selectedLogId: -1,
+		time:          opts.timeDisplay,
+		theme:         opts.theme,
+		rules:         opts.rules,
+	}
+	app.contextSize = defaultContextSize
+	app.context = tview.NewTable().SetSelectable(true, false).SetFixed(1, 2)
+	app.context.SetContent(&app.contextContent)
+	app.context.SetBorder(true)
+	app.context.SetSelectionChangedFunc(
+		func(row, col int) { app.contextContent.selectionChanged(row, col) },
+	)
+	app.context.SetSelectedFunc(func(row, col int) {
+		app.pages.HidePage("context")
+		app.showLog(app.contextContent.logs[row-1].id)
+	})
+	app.pages.AddPage("context", app.context, true, false)
+
+	app.fields = tview.NewTable().SetSelectable(true, false).SetFixed(1, 1)
+	app.fields.SetBorder(true).SetTitle(" Fields - press Enter to sort by a field, h to chart it, Esc to close ")
+	app.fields.SetSelectedFunc(func(row, col int) { app.sortByField(row) })
+	app.pages.AddPage("fields", app.fields, true, false)
+
+	app.chart = tview.NewTextView()
+	app.chart.SetBorder(true)
+	app.pages.AddPage("chart", app.chart, true, false)
+
+	app.output = tview.NewTextView().SetDynamicColors(true)
+	app.output.SetBorder(true)
+	app.pages.AddPage("output", app.output, true, false)
+
+	app.input = tview.NewInputField()
+	app.input.SetBorder(true)
+	app.pages.AddPage("prompt", modal(app.input, 72, 3), true, false)
+
+	app.bindActions()
 
 	app.Application = tview.NewApplication()
 	app.SetRoot(app.pages, true)
+	app.SetBeforeDrawFunc(func(screen tcell.Screen) bool {
+		if app.beep {
+			screen.Beep()
+			app.beep = false
+		}
+		return false
+	})
+	if app.alerts != nil {
+		app.alerts.setNotify(app.alertFired)
+	}
 	app.SetInputCapture(func(e *tcell.EventKey) *tcell.EventKey {
-		key := e.Key()
-		slog.Debug("received key event", "key", key)
-		switch key {
-		case tcell.KeyRune:
-			if e.Rune() == 'q' {
-				app.Stop()
+		slog.Debug("received key event", "key", e.Name())
+		action, ok := app.keymap.lookup(e)
+
+		if page, _ := app.pages.GetFrontPage(); page == "prompt" {
+			// the input field handles every key, closing on Enter or Esc
+			return e
+		} else if page != "main" {
+			if e.Key() == tcell.KeyEscape || action == "quit" || action == page {
+				app.pages.HidePage(page)
 				return nil
 			}
+			if handler, ok := app.pageActions[page][action]; ok {
+				handler()
+				return nil
+			}
+			return e
+		}
+
+		if !ok {
+			return e
+		}
+		if handler, ok := app.actions[action]; ok {
+			handler()
+			return nil
 		}
 		return e
 	})
@@ -58,22 +257,916 @@ func newApplication(db *DB) *tview.Application {
 	return app.Application
 }
 
+// bindActions sets the handlers of the actions listed in keyActions.
+func (app *application) bindActions() {
+	app.actions = map[string]func(){
+		"help":      func() { app.pages.ShowPage("help") },
+		"quit":      func() { app.Stop() },
+		"down":      func() { app.moveSelection(1) },
+		"up":        func() { app.moveSelection(-1) },
+		"page-down": func() { app.moveSelection(app.halfPage()) },
+		"page-up":   func() { app.moveSelection(-app.halfPage()) },
+		"top":       func() { app.moveSelection(-app.table.GetRowCount()) },
+		"bottom":    func() { app.moveSelection(app.table.GetRowCount()) },
+		"time-mode": func() {
+			app.content.time.next()
+		},
+		"toggle-delta": func() {
+			app.content.time.showDelta = !app.content.time.showDelta
+		},
+		"restart": func() {
+			if app.child != nil {
+				go app.runChildAction(app.child.restart)
+			}
+		},
+		"kill": func() {
+			if app.child != nil {
+				go app.runChildAction(app.child.kill)
+			}
+		},
+		"trace":     app.toggleTraceFilter,
+		"patterns":  func() { go app.showPatterns() },
+		"anomalies": func() { go app.showAnomalies() },
+		"alerts":    app.showAlerts,
+		"mark": func() {
+			if l, ok := app.selectedLog(); ok {
+				go app.toggleBookmark(l.id)
+			}
+		},
+		"note":             app.editNote,
+		"next-mark":        func() { app.moveToMark(1) },
+		"prev-mark":        func() { app.moveToMark(-1) },
+		"bookmarks":        func() { go app.showBookmarks() },
+		"export-bookmarks": app.promptExport,
+		"yank-message": func() {
+			if l, ok := app.selectedLog(); ok {
+				app.yank("message", l.message)
+			}
+		},
+		"yank-json": func() {
+			if l, ok := app.selectedLog(); ok {
+				app.yankLogs("log", []log{l})
+			}
+		},
+		"yank-field": app.promptYankField,
+		"yank-logs": func() {
+			logs := app.selectedLogs()
+			switch len(logs) {
+			case 0:
+			case 1:
+				app.yankLogs("log", logs)
+			default:
+				app.yankLogs(fmt.Sprintf("%d logs", len(logs)), logs)
+			}
+		},
+		"open": func() {
+			if l, ok := app.selectedLog(); ok {
+				app.openLogs([]log{l})
+			}
+		},
+		"open-all": func() {
+			if len(app.content.logs) > 0 {
+				app.openLogs(app.content.logs)
+			}
+		},
+		"pipe": func() {
+			if l, ok := app.selectedLog(); ok {
+				app.promptPipe([]log{l})
+			}
+		},
+		"pipe-all": func() {
+			if len(app.content.logs) > 0 {
+				app.promptPipe(app.content.logs)
+			}
+		},
+		"context": func() {
+			if l, ok := app.selectedLog(); ok {
+				app.contextId = l.id
+				go app.showContext(app.contextId, app.contextSize)
+			}
+		},
+		"fields": func() { go app.showFields() },
+		"chart":  app.promptChart,
+		"clear-filter": func() {
+			if app.filter != nil || app.timeRange.Load() != nil || app.sortField.Load() != nil {
+				app.filter = nil
+				app.timeRange.Store(nil)
+				app.sortField.Store(nil)
+				go app.updateMain()
+			}
+		},
+		"pause": func() {
+			if app.replay != nil {
+				app.replay.togglePause()
+				go app.updateMain()
+			}
+		},
+		"step": func() {
+			if app.replay != nil {
+				app.replay.step()
+			}
+		},
+		"faster": func() {
+			if app.replay != nil {
+				app.replay.scaleSpeed(2)
+				go app.updateMain()
+			}
+		},
+		"slower": func() {
+			if app.replay != nil {
+				app.replay.scaleSpeed(0.5)
+				go app.updateMain()
+			}
+		},
+	}
+
+	app.pageActions = map[string]map[string]func(){
+		"fields": {
+			"chart": func() {
+				row, _ := app.fields.GetSelection()
+				if field, ok := app.fields.GetCell(row, 0).GetReference().(string); ok {
+					app.pages.HidePage("fields")
+					app.showChart(field)
+				}
+			},
+		},
+		"context": {
+			"more-context": func() {
+				app.contextSize += contextStep
+				go app.showContext(app.contextId, app.contextSize)
+			},
+			"less-context": func() {
+				if app.contextSize > contextStep {
+					app.contextSize -= contextStep
+					go app.showContext(app.contextId, app.contextSize)
+				}
+			},
+		},
+	}
+}
+
+// traceKeys are the fields holding the trace ID of a log, as written by
+// OpenTelemetry and common logging libraries.
+var traceKeys = []string{"trace_id", "traceId", "traceID", "trace.id"}
+
+// toggleTraceFilter shows only the logs of the selected log's trace, or all
+// logs if a filter is already set.
+func (app *application) toggleTraceFilter() {
+	if app.filter != nil {
+		app.filter = nil
+		go app.updateMain()
+		return
+	}
+
+	l, ok := app.selectedLog()
+	if !ok {
+		return
+	}
+	for _, key := range traceKeys {
+		traceID, ok := lookupField(l.data, key)
+		if !ok || traceID == nil || traceID == "" {
+			continue
+		}
+		app.filter = newEqualCondition(key, traceID)
+		go app.updateMain()
+		return
+	}
+}
+
+// selectedLog returns the log on the selected row of the table.
+func (app *application) selectedLog() (log, bool) {
+	row, _ := app.table.GetSelection()
+	if row < 1 || row > len(app.content.logs) {
+		return log{}, false
+	}
+	return app.content.logs[row-1], true
+}
+
+// selectedLogs returns the marked logs shown in the table, or the selected log
+// if none is marked.
+func (app *application) selectedLogs() []log {
+	logs := []log{}
+	for _, l := range app.content.logs {
+		if l.marked {
+			logs = append(logs, l)
+		}
+	}
+	if len(logs) == 0 {
+		if l, ok := app.selectedLog(); ok {
+			logs = append(logs, l)
+		}
+	}
+	return logs
+}
+
+// prompt asks for a line of text, starting from text, and calls done with it
+// unless the user cancels with Esc.
+func (app *application) prompt(title, text string, done func(string)) {
+	app.input.SetTitle(" " + title + " - press Enter to confirm, Esc to cancel ")
+	app.input.SetText(text)
+	app.input.SetDoneFunc(func(key tcell.Key) {
+		app.pages.HidePage("prompt")
+		if key == tcell.KeyEnter {
+			done(app.input.GetText())
+		}
+	})
+	app.pages.ShowPage("prompt")
+}
+
+// noticeDuration is how long notices stay in the header.
+const noticeDuration = 5 * time.Second
+
+// showNotice shows text in the header for a few seconds.
+func (app *application) showNotice(text string) {
+	app.notice = text
+	app.noticeUntil = time.Now().Add(noticeDuration)
+	go app.updateMain()
+}
+
+// yank copies text to the clipboard, and tells what was copied.
+func (app *application) yank(what, text string) {
+	go func() {
+		err := app.copyToClipboard(text)
+		app.QueueUpdateDraw(func() {
+			if err != nil {
+				slog.Error("couldn't copy to clipboard", "error", err)
+				app.showNotice(err.Error())
+				return
+			}
+			app.showNotice("copied " + what)
+		})
+	}()
+}
+
+// copyToClipboard copies text with OSC 52, or with a clipboard tool when the
+// terminal doesn't support OSC 52 or the sequence can't be written. It waits
+// for the UI goroutine, so it must not run on it.
+func (app *application) copyToClipboard(text string) error {
+	seq, ok := osc52Sequence(text, os.Getenv, tmuxOption)
+	if !ok {
+		return clipboardError(errNoOSC52, copyWithTool(text))
+	}
+	// the escape sequence is written between draws, on the UI goroutine
+	done := make(chan error, 1)
+	app.QueueUpdate(func() { done <- writeTerminal(seq) })
+	err := <-done
+	if err != nil {
+		return clipboardError(err, copyWithTool(text))
+	}
+	return nil
+}
+
+// yankLogs copies the JSON of logs, one per line.
+func (app *application) yankLogs(what string, logs []log) {
+	builder := strings.Builder{}
+	err := writeLogs(&builder, logs)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+	app.yank(what, strings.TrimSuffix(builder.String(), "\n"))
+}
+
+// promptYankField prompts for a field of the selected log and copies its
+// value.
+func (app *application) promptYankField() {
+	l, ok := app.selectedLog()
+	if !ok {
+		return
+	}
+	app.prompt("Copy field", "", func(name string) {
+		v, ok := lookupField(l.data, name)
+		if !ok {
+			app.showNotice("no field " + name)
+			return
+		}
+		text, err := fieldText(v)
+		if err != nil {
+			slog.Error(err.Error())
+			return
+		}
+		app.yank(name, text)
+	})
+}
+
+// openLogs suspends the user interface to open logs as pretty JSON with the
+// pager or editor. Logs are still ingested in the meantime.
+func (app *application) openLogs(logs []log) {
+	path, err := writeTempLogs(logs)
+	if err != nil {
+		slog.Error(err.Error())
+		app.showNotice(err.Error())
+		return
+	}
+	defer os.Remove(path)
+
+	app.suspended.Store(true)
+	app.Suspend(func() { err = openFile(pagerCommand(), path) })
+	app.suspended.Store(false)
+	if err != nil {
+		slog.Error(err.Error())
+		app.showNotice(err.Error())
+		return
+	}
+	go app.updateMain()
+}
+
+// promptPipe prompts for a shell command and pipes logs to it.
+func (app *application) promptPipe(logs []log) {
+	app.prompt(fmt.Sprintf("Pipe %d logs to", len(logs)), app.pipeCommand, func(command string) {
+		if command == "" {
+			return
+		}
+		app.pipeCommand = command
+		go app.pipe(command, logs)
+	})
+}
+
+// pipe runs command with logs on stdin, and shows its output.
+func (app *application) pipe(command string, logs []log) {
+	output, status, err := pipeLogs(command, logs)
+	app.QueueUpdateDraw(func() {
+		if err != nil {
+			slog.Error(err.Error())
+			app.showNotice(err.Error())
+			return
+		}
+		app.output.SetTitle(fmt.Sprintf(" | %s - %s - press Esc to close ", tview.Escape(command), status))
+		app.output.SetText(tview.TranslateANSI(tview.Escape(output)))
+		app.output.ScrollToBeginning()
+		app.pages.ShowPage("output")
+	})
+}
+
+// toggleBookmark marks or unmarks the log with the given row id.
+func (app *application) toggleBookmark(id int64) {
+	_, err := app.db.toggleBookmark(id)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+	app.updateMain()
+}
+
+// editNote prompts for the note of the selected log, marking it.
+func (app *application) editNote() {
+	l, ok := app.selectedLog()
+	if !ok {
+		return
+	}
+	app.prompt("Note", l.note, func(note string) {
+		go func() {
+			err := app.db.setBookmarkNote(l.id, note)
+			if err != nil {
+				slog.Error(err.Error())
+				return
+			}
+			app.updateMain()
+		}()
+	})
+}
+
+// moveToMark selects the next marked log down the table if direction is
+// positive, or up the table otherwise.
+func (app *application) moveToMark(direction int) {
+	row, _ := app.table.GetSelection()
+	for i := row - 1 + direction; i >= 0 && i < len(app.content.logs); i += direction {
+		if app.content.logs[i].marked {
+			app.table.Select(i+1, 0)
+			return
+		}
+	}
+}
+
+// showBookmarks lists the marked logs with their notes, newest first.
+func (app *application) showBookmarks() {
+	bookmarks, err := app.db.queryBookmarks()
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	app.QueueUpdateDraw(func() {
+		app.bookmarks.Clear()
+		for col, title := range []string{"timestamp", "level", "note", "message"} {
+			cell := tview.NewTableCell(title).SetSelectable(false)
+			applyStyle(cell, app.theme.header)
+			app.bookmarks.SetCell(0, col, cell)
+		}
+
+		now := time.Now()
+		for i, b := range bookmarks {
+			row := i + 1
+			app.bookmarks.SetCell(row, 0, tview.NewTableCell(app.content.time.format(b.log.timestamp, now)).
+				SetReference(b.log.id))
+			level := tview.NewTableCell(b.log.level)
+			if style, ok := app.theme.levels[b.log.severity]; ok {
+				applyStyle(level, style)
+			}
+			app.bookmarks.SetCell(row, 1, level)
+			app.bookmarks.SetCell(row, 2, tview.NewTableCell(tview.Escape(b.log.note)).SetMaxWidth(40))
+			app.bookmarks.SetCell(row, 3, tview.NewTableCell(tview.Escape(b.log.message)).SetExpansion(1))
+		}
+		app.bookmarks.Select(1, 0).ScrollToBeginning()
+		app.pages.ShowPage("bookmarks")
+	})
+}
+
+// jumpToBookmark selects the log on row of the bookmarks table.
+func (app *application) jumpToBookmark(row int) {
+	id, ok := app.bookmarks.GetCell(row, 0).GetReference().(int64)
+	if !ok {
+		return
+	}
+	app.pages.HidePage("bookmarks")
+	app.showLog(id)
+}
+
+// showLog selects the log with the given row id in the table, showing all
+// logs if it is filtered out.
+func (app *application) showLog(id int64) {
+	shown := slices.IndexFunc(app.content.logs, func(l log) bool { return l.id == id }) >= 0
+	if !shown {
+		app.filter = nil
+		app.timeRange.Store(nil)
+	}
+	app.content.selectedLogId = id
+	go app.updateMain()
+}
+
+const (
+	// defaultContextSize is the number of logs shown before and after the
+	// log of the context page.
+	defaultContextSize = 10
+	// contextStep is the number of logs added or removed on each side of the
+	// context page.
+	contextStep = 5
+)
+
+// showContext shows the size logs before and after the log with the given id,
+// across all logs, with that log highlighted. It runs off the UI goroutine, so
+// the id and size are passed rather than read from the application.
+func (app *application) showContext(id int64, size int) {
+	logs, err := app.db.queryContext(id, size, size)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	app.QueueUpdateDraw(func() {
+		app.context.SetTitle(fmt.Sprintf(
+			" Context - %d logs before and after, press %s or %s to change, Enter to show a log, Esc to close ",
+			size,
+			tview.Escape(strings.Join(app.keymap.keys["more-context"], "/")),
+			tview.Escape(strings.Join(app.keymap.keys["less-context"], "/")),
+		))
+		app.contextContent.logs = logs
+		app.contextContent.columns = app.contextContent.getColumns()
+		app.contextContent.highlightId = id
+		for i, l := range logs {
+			if l.id == id {
+				app.context.Select(i+1, 0)
+				break
+			}
+		}
+		app.pages.ShowPage("context")
+	})
+}
+
+// defaultExportPath is the file bookmarks are exported to by default.
+const defaultExportPath = "ltop-bookmarks.jsonl"
+
+// promptExport prompts for a file and exports the bookmarks to it.
+func (app *application) promptExport() {
+	app.prompt("Export bookmarks to", defaultExportPath, func(path string) {
+		go app.exportBookmarks(path)
+	})
+}
+
+// exportBookmarks writes the bookmarks to the file at path as JSON lines.
+func (app *application) exportBookmarks(path string) {
+	notice := ""
+	bookmarks, err := app.db.queryBookmarks()
+	if err == nil {
+		err = writeBookmarks(path, bookmarks)
+	}
+	if err != nil {
+		slog.Error(err.Error())
+		notice = err.Error()
+	} else {
+		notice = fmt.Sprintf("exported %d bookmarks to %s", len(bookmarks), path)
+	}
+	app.QueueUpdateDraw(func() { app.showNotice(notice) })
+}
+
+// showFields lists the fields of the logs with the statistics of their
+// values.
+func (app *application) showFields() {
+	summaries := app.db.fields.summaries()
+	untracked := app.db.fields.untrackedValues()
+
+	app.QueueUpdateDraw(func() {
+		app.fields.Clear()
+		titles := []string{"field", "types", "null", "distinct", "min", "p50", "p90", "p99", "max"}
+		for col, title := range titles {
+			cell := tview.NewTableCell(title).SetSelectable(false)
+			applyStyle(cell, app.theme.header)
+			app.fields.SetCell(0, col, cell)
+		}
+
+		for i, s := range summaries {
+			row := i + 1
+			app.fields.SetCell(row, 0, tview.NewTableCell(tview.Escape(s.name)).SetReference(s.name))
+			app.fields.SetCellSimple(row, 1, formatCounts(s.types))
+			app.fields.SetCell(row, 2, tview.NewTableCell(fmt.Sprintf("%.0f%%", s.nullRate*100)).
+				SetAlign(tview.AlignRight))
+			app.fields.SetCell(row, 3, tview.NewTableCell(fmt.Sprint(s.distinct)).SetAlign(tview.AlignRight))
+			if s.numbers > 0 {
+				for col, n := range []float64{s.min, s.p50, s.p90, s.p99, s.max} {
+					app.fields.SetCell(row, 4+col, tview.NewTableCell(formatStat(n)).SetAlign(tview.AlignRight))
+				}
+			}
+		}
+		if untracked > 0 {
+			text := fmt.Sprintf("%d values of fields beyond the first %d not shown", untracked, maxFields)
+			app.fields.SetCell(len(summaries)+1, 0, tview.NewTableCell(text).SetSelectable(false))
+		}
+		app.fields.Select(1, 0).ScrollToBeginning()
+		app.pages.ShowPage("fields")
+	})
+}
+
+// formatStat formats a field statistic with up to 6 significant digits.
+func formatStat(n float64) string {
+	return strconv.FormatFloat(n, 'g', 6, 64)
+}
+
+// sortByField sorts the table by the field on row of the fields table, or by
+// timestamp if it is already sorted by that field.
+func (app *application) sortByField(row int) {
+	field, ok := app.fields.GetCell(row, 0).GetReference().(string)
+	if !ok {
+		return
+	}
+	if current := app.sortField.Load(); current != nil && *current == field {
+		app.sortField.Store(nil)
+	} else {
+		app.sortField.Store(&field)
+	}
+	app.content.selectedLogId = -1
+	app.pages.HidePage("fields")
+	go app.updateMain()
+}
+
+// promptChart prompts for a numeric field and charts it.
+func (app *application) promptChart() {
+	field := app.chartField
+	if sortField := app.sortField.Load(); field == "" && sortField != nil {
+		field = *sortField
+	}
+	app.prompt("Chart field", field, func(field string) {
+		if field != "" {
+			app.showChart(field)
+		}
+	})
+}
+
+// showChart shows the distribution of the numeric values of field, and their
+// percentiles over time, for the logs shown in the table.
+func (app *application) showChart(field string) {
+	app.chartField = field
+	scope := chartScope{to: time.Now()}
+	if r := app.timeRange.Load(); r != nil {
+		scope.from, scope.to = r.from, r.to
+	}
+	if app.filter != nil {
+		scope.ids = make([]int64, 0, len(app.content.logs))
+		for _, l := range app.content.logs {
+			scope.ids = append(scope.ids, l.id)
+		}
+	}
+	go app.drawChart(field, scope)
+}
+
+// drawChart queries the values of field and draws the chart page.
+func (app *application) drawChart(field string, scope chartScope) {
+	stats, err := app.db.queryNumericStats(field, scope)
+	var histogram []histogramBin
+	var percentiles []percentileBucket
+	size := chartBucketSize(stats)
+	if err == nil && stats.count > 0 {
+		histogram, err = app.db.queryHistogram(field, scope, stats, histogramBins)
+	}
+	if err == nil && stats.count > 0 {
+		percentiles, err = app.db.queryPercentiles(field, scope, size)
+	}
+
+	app.QueueUpdateDraw(func() {
+		if err != nil {
+			slog.Error(err.Error())
+			app.showNotice(err.Error())
+			return
+		}
+		if stats.count == 0 {
+			app.showNotice("no numeric values of " + field)
+			return
+		}
+
+		now := time.Now()
+		text := fmt.Sprintf(
+			"%d values from %s to %s\n\nDistribution\n\n%s\nPercentiles over time\n\n%s",
+			stats.count,
+			formatStat(stats.min),
+			formatStat(stats.max),
+			drawHistogram(histogram),
+			drawPercentiles(percentiles, stats.first, size, func(t time.Time) string {
+				return app.content.time.format(t, now)
+			}),
+		)
+		app.chart.SetTitle(fmt.Sprintf(" Chart - %s - press Esc to close ", tview.Escape(field)))
+		app.chart.SetText(text)
+		app.chart.ScrollToBeginning()
+		app.pages.ShowPage("chart")
+	})
+}
+
+// showPatterns lists the message templates with their counts, time range and
+// levels.
+func (app *application) showPatterns() {
+	stats, err := app.db.queryTemplates(time.Time{}, time.Now())
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	app.QueueUpdateDraw(func() {
+		app.patterns.Clear()
+		for col, title := range []string{"count", "first seen", "last seen", "levels", "template"} {
+			cell := tview.NewTableCell(title).SetSelectable(false)
+			applyStyle(cell, app.theme.header)
+			app.patterns.SetCell(0, col, cell)
+		}
+
+		now := time.Now()
+		for i, ts := range stats {
+			row := i + 1
+			app.patterns.SetCell(row, 0, tview.NewTableCell(fmt.Sprint(ts.count)).
+				SetAlign(tview.AlignRight).
+				SetReference(ts.id))
+			app.patterns.SetCellSimple(row, 1, app.content.time.format(ts.first, now))
+			app.patterns.SetCellSimple(row, 2, app.content.time.format(ts.last, now))
+			app.patterns.SetCellSimple(row, 3, formatCounts(ts.levels))
+			app.patterns.SetCell(row, 4, tview.NewTableCell(tview.Escape(ts.template)).SetExpansion(1))
+		}
+		app.patterns.Select(1, 0).ScrollToBeginning()
+		app.pages.ShowPage("patterns")
+	})
+}
+
+// showAnomalies lists the spikes of the volume and error rates, newest first.
+func (app *application) showAnomalies() {
+	anomalies := app.db.rates.anomalies()
+
+	app.QueueUpdateDraw(func() {
+		app.anomalies.Clear()
+		for col, title := range []string{"start", "duration", "metric", "peak/s", "baseline/s", "z-score"} {
+			cell := tview.NewTableCell(title).SetSelectable(false)
+			applyStyle(cell, app.theme.header)
+			app.anomalies.SetCell(0, col, cell)
+		}
+
+		now := time.Now()
+		for i := range anomalies {
+			a := anomalies[len(anomalies)-1-i]
+			row := i + 1
+			app.anomalies.SetCell(row, 0, tview.NewTableCell(app.content.time.format(a.start, now)).
+				SetReference(logRange{from: a.start, to: a.end}))
+			app.anomalies.SetCell(row, 1, tview.NewTableCell(formatDuration(a.end.Sub(a.start)+time.Second)).
+				SetAlign(tview.AlignRight))
+			app.anomalies.SetCellSimple(row, 2, a.metric)
+			app.anomalies.SetCell(row, 3, tview.NewTableCell(fmt.Sprint(a.peak)).SetAlign(tview.AlignRight))
+			app.anomalies.SetCell(row, 4, tview.NewTableCell(fmt.Sprintf("%.1f", a.baseline)).SetAlign(tview.AlignRight))
+			app.anomalies.SetCell(row, 5, tview.NewTableCell(fmt.Sprintf("%.1f", a.score)).
+				SetAlign(tview.AlignRight).
+				SetExpansion(1))
+		}
+		app.anomalies.Select(1, 0).ScrollToBeginning()
+		app.pages.ShowPage("anomalies")
+	})
+}
+
+// alertFlash is how long the header flashes after an alert.
+const alertFlash = 2 * time.Second
+
+// alertFired flashes the header and rings the bell. It is called by the
+// alerter when a rule fires.
+func (app *application) alertFired(f alertFiring) {
+	// logs are appended while the user interface is suspended, when queued
+	// updates wait, so don't block ingestion
+	go app.QueueUpdateDraw(func() {
+		app.flashUntil = time.Now().Add(alertFlash)
+		app.beep = true
+		app.styleHeader()
+	})
+}
+
+// styleHeader sets the header colors, which are those of errors while an
+// alert flashes.
+func (app *application) styleHeader() {
+	style := defaultStyle.
+		Foreground(tview.Styles.PrimaryTextColor).
+		Background(tview.Styles.PrimitiveBackgroundColor)
+	if time.Now().Before(app.flashUntil) {
+		style = app.theme.levels[severityError]
+	}
+	_, bg, _ := style.Decompose()
+	app.header.SetTextStyle(style)
+	app.header.Box.SetBackgroundColor(bg)
+}
+
+// showAlerts lists the alerts fired, newest first.
+func (app *application) showAlerts() {
+	if app.alerts == nil {
+		return
+	}
+	firings := app.alerts.firings()
+
+	app.alertList.Clear()
+	for col, title := range []string{"fired", "rule", "count", "level", "timestamp", "message"} {
+		cell := tview.NewTableCell(title).SetSelectable(false)
+		applyStyle(cell, app.theme.header)
+		app.alertList.SetCell(0, col, cell)
+	}
+
+	now := time.Now()
+	for i := range firings {
+		f := firings[len(firings)-1-i]
+		row := i + 1
+		app.alertList.SetCellSimple(row, 0, app.content.time.format(f.fired, now))
+		app.alertList.SetCellSimple(row, 1, tview.Escape(f.rule))
+		app.alertList.SetCell(row, 2, tview.NewTableCell(fmt.Sprint(f.count)).SetAlign(tview.AlignRight))
+		level := tview.NewTableCell(f.log.level)
+		if style, ok := app.theme.levels[f.log.severity]; ok {
+			applyStyle(level, style)
+		}
+		app.alertList.SetCell(row, 3, level)
+		app.alertList.SetCellSimple(row, 4, app.content.time.format(f.log.timestamp, now))
+		app.alertList.SetCell(row, 5, tview.NewTableCell(tview.Escape(f.log.message)).SetExpansion(1))
+	}
+	app.alertList.Select(1, 0).ScrollToBeginning()
+	app.pages.ShowPage("alerts")
+}
+
+// anomalyMargin is the time shown before and after a spike.
+const anomalyMargin = 30 * time.Second
+
+// jumpToAnomaly shows the logs around the spike on row of the anomalies
+// table.
+func (app *application) jumpToAnomaly(row int) {
+	r, ok := app.anomalies.GetCell(row, 0).GetReference().(logRange)
+	if !ok {
+		return
+	}
+	app.timeRange.Store(&logRange{from: r.from.Add(-anomalyMargin), to: r.to.Add(anomalyMargin)})
+	app.content.selectedLogId = -1
+	app.pages.HidePage("anomalies")
+	go app.updateMain()
+}
+
+// filterTemplate shows only the logs of the template on row of the patterns
+// table.
+func (app *application) filterTemplate(row int) {
+	id, ok := app.patterns.GetCell(row, 0).GetReference().(int64)
+	if !ok {
+		return
+	}
+	app.filter = newEqualCondition(templateField, float64(id))
+	app.pages.HidePage("patterns")
+	go app.updateMain()
+}
+
+// formatCounts lists names, such as levels, by decreasing count, e.g.
+// "info 12, error 3".
+func formatCounts(levels map[string]int) string {
+	names := make([]string, 0, len(levels))
+	for name := range levels {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) bool {
+		if levels[a] != levels[b] {
+			return levels[a] > levels[b]
+		}
+		return a < b
+	})
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		if name == "" {
+			parts = append(parts, fmt.Sprintf("- %d", levels[name]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s %d", name, levels[name]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// runChildAction runs an action on the monitored command, which may block
+// until it exits, and refreshes the header.
+func (app *application) runChildAction(action func() error) {
+	err := action()
+	if err != nil {
+		slog.Error("command action failed", "error", err)
+	}
+	app.updateMain()
+}
+
+// moveSelection moves the selected row by delta rows, staying within the
+// table.
+func (app *application) moveSelection(delta int) {
+	if len(app.content.logs) == 0 {
+		return
+	}
+	row, _ := app.table.GetSelection()
+	row += delta
+	if row < 1 {
+		row = 1
+	}
+	if row > len(app.content.logs) {
+		row = len(app.content.logs)
+	}
+	app.table.Select(row, 0)
+}
+
+// halfPage returns half the number of visible rows in the table.
+func (app *application) halfPage() int {
+	_, _, _, height := app.table.GetInnerRect()
+	if height < 4 {
+		return 1
+	}
+	return (height - 1) / 2
+}
+
+// modal centers p in a box of the given size.
+func modal(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(
+			tview.NewFlex().
+				SetDirection(tview.FlexRow).
+				AddItem(nil, 0, 1, false).
+				AddItem(p, height, 1, true).
+				AddItem(nil, 0, 1, false),
+			width, 1, true,
+		).
+		AddItem(nil, 0, 1, false)
+}
+
 func (app *application) pollingLoop() {
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
 	for range ticker.C {
-		app.updateMain()
+		if !app.suspended.Load() {
+			app.updateMain()
+		}
 	}
 }
 
 func (app *application) updateMain() {
-	logs, err := app.db.queryLogs(time.Time{}, time.Now())
+	tr := logRange{to: time.Now()}
+	if r := app.timeRange.Load(); r != nil {
+		tr = *r
+	}
+	sortField := ""
+	if field := app.sortField.Load(); field != nil {
+		sortField = *field
+	}
+	logs, err := app.db.queryLogsSorted(tr.from, tr.to, sortField)
 	if err != nil {
 		slog.Error(err.Error())
 		return
 	}
 
+	stats := headerStats{
+		status:     app.inputStatus(),
+		timeErrors: app.db.timeErrorCount(),
+		rates:      app.db.rates.recent(sparklineWidth),
+		anomalies:  app.db.rates.anomalies(),
+	}
+	if app.alerts != nil {
+		stats.alerts = len(app.alerts.firings())
+	}
+	if app.timeRange.Load() != nil {
+		stats.timeRange = &tr
+	}
+	stats.sortField = sortField
+
 	app.QueueUpdateDraw(func() {
+		if app.filter != nil {
+			logs = filterLogs(logs, app.filter.withFieldTypes(app.db.fields.isNumeric))
+		}
+		stats.logCount = len(logs)
+		app.updateHeader(stats)
+		app.styleHeader()
 		app.content.logs = logs
 		app.content.columns = []string{}
 
@@ -95,14 +1188,95 @@ func (app *application) updateMain() {
 	})
 }
 
+// filterLogs returns the logs matching c.
+func filterLogs(logs []log, c *condition) []log {
+	filtered := make([]log, 0, len(logs))
+	for i := range logs {
+		if c.match(&logs[i]) {
+			filtered = append(filtered, logs[i])
+		}
+	}
+	return filtered
+}
+
+// inputStatus describes the state of the monitored command or of the input,
+// and of the replay.
+func (app *application) inputStatus() string {
+	if app.child != nil {
+		return app.child.status()
+	}
+	if app.inputDone != nil {
+		select {
+		case <-app.inputDone:
+			return "input closed"
+		default:
+		}
+	}
+	if app.replay != nil {
+		return app.replay.status()
+	}
+	return ""
+}
+
+// headerStats holds the figures shown in the header.
+type headerStats struct {
+	logCount   int
+	timeErrors int64
+	status     string
+	timeRange  *logRange
+	rates      []rateBucket
+	anomalies  []anomaly
+	alerts     int
+	sortField  string
+}
+
+func (app *application) updateHeader(stats headerStats) {
+	text := ""
+	if len(stats.rates) > 0 {
+		end := stats.rates[len(stats.rates)-1].time
+		text += rateSparkline(stats.rates, stats.anomalies, end, sparklineWidth, app.theme.errorTag) + "  "
+	}
+	text += fmt.Sprintf("%d logs  time: %s", stats.logCount, app.content.time.name())
+	if stats.timeRange != nil {
+		now := time.Now()
+		text += fmt.Sprintf(
+			"  range: %s - %s",
+			app.content.time.format(stats.timeRange.from, now),
+			app.content.time.format(stats.timeRange.to, now),
+		)
+	}
+	if app.filter != nil {
+		text += "  filter: " + tview.Escape(app.filter.source)
+	}
+	if stats.sortField != "" {
+		text += "  sort: " + tview.Escape(stats.sortField)
+	}
+	if stats.status != "" {
+		text += "  " + tview.Escape(stats.status)
+	}
+	if stats.timeErrors > 0 {
+		text += fmt.Sprintf("  %s%d unparsed timestamps[-:-:-]", app.theme.errorTag, stats.timeErrors)
+	}
+	if len(stats.anomalies) > 0 {
+		text += fmt.Sprintf("  %sanomalies: %d[-:-:-]", app.theme.errorTag, len(stats.anomalies))
+	}
+	if stats.alerts > 0 {
+		text += fmt.Sprintf("  %salerts: %d[-:-:-]", app.theme.errorTag, stats.alerts)
+	}
+	if time.Now().Before(app.noticeUntil) {
+		text += "  " + tview.Escape(app.notice)
+	}
+	app.header.SetText(text)
+}
+
 func (tc *tableContent) getColumns() []string {
 	columnSet := map[string]struct{}{}
 	for _, log := range tc.logs {
 		for k, v := range log.data {
-			if k == "timestamp" || k == "time" || k == "date" {
+			if slices.Contains(timestampKeys, k) {
 				continue
 			}
-			if k == "level" || k == "lvl" {
+			if slices.Contains(levelKeys, k) {
 				continue
 			}
 			if k == "msg" || k == "message" {
@@ -121,66 +1295,90 @@ func (tc *tableContent) getColumns() []string {
 	return columns
 }
 
+// fixedColumns returns the names of the columns displayed before the log
+// fields.
+func (tc *tableContent) fixedColumns() []string {
+	if tc.time.showDelta {
+		return []string{"level", "timestamp", "delta", "message"}
+	}
+	return []string{"level", "timestamp", "message"}
+}
+
 func (tc *tableContent) GetCell(row, col int) *tview.TableCell {
+	fixed := tc.fixedColumns()
+	column := ""
+	if col < len(fixed) {
+		column = fixed[col]
+	} else {
+		column = "." + tc.columns[col-len(fixed)]
+	}
 	if row == 0 {
-		return tc.getHeaderCell(row, col)
+		return tc.getHeaderCell(column)
 	} else {
-		return tc.getContentCell(row-1, col)
+		return tc.getContentCell(row-1, column)
 	}
 }
 
-func (tc *tableContent) getHeaderCell(row, col int) *tview.TableCell {
-	cell := tview.NewTableCell("").
-		SetTextColor(tcell.ColorBlack).
-		SetBackgroundColor(tcell.ColorPurple).
-		SetSelectable(false)
-	switch col {
-	case 0:
-		cell.SetText("level")
-	case 1:
-		cell.SetText("timestamp")
-	case 2:
+// getHeaderCell returns the header cell for column. Log field columns are
+// prefixed with a dot.
+func (tc *tableContent) getHeaderCell(column string) *tview.TableCell {
+	cell := tview.NewTableCell("").SetSelectable(false)
+	applyStyle(cell, tc.theme.header)
+	switch column {
+	case "level", "delta":
+		cell.SetText(column)
+	case "timestamp":
+		cell.SetText(fmt.Sprintf("timestamp (%s)", tc.time.name()))
+	case "message":
 		cell.SetText("message")
 		cell.SetMaxWidth(80)
 		cell.SetExpansion(1)
 	default:
-		cell.SetText(tc.columns[col-3])
+		cell.SetText(column[1:])
 	}
 	return cell
 }
 
-func (tc *tableContent) getContentCell(row, col int) *tview.TableCell {
+// markPrefix is shown before the level of marked logs.
+const markPrefix = "* "
+
+func (tc *tableContent) getContentCell(row int, column string) *tview.TableCell {
 	cell := tview.NewTableCell("")
 	log := tc.logs[row]
-	switch col {
-	case 0:
-		cell.SetText(log.level)
-		switch log.level {
-		case "error":
-			cell.SetTextColor(tcell.ColorBlack)
-			cell.SetBackgroundColor(tcell.ColorRed)
-		case "warn":
-			cell.SetTextColor(tcell.ColorBlack)
-			cell.SetBackgroundColor(tcell.ColorYellow)
-		case "info":
-			cell.SetTextColor(tcell.ColorBlack)
-			cell.SetBackgroundColor(tcell.ColorBlue)
-		case "debug":
-			cell.SetTextColor(tcell.ColorBlack)
-			cell.SetBackgroundColor(tcell.ColorGreen)
-		}
-	case 1:
-		cell.SetText(log.timestamp.Format(time.StampMilli))
-	case 2:
+	switch column {
+	case "level":
+		if log.marked {
+			cell.SetText(markPrefix + log.level)
+		} else {
+			cell.SetText(log.level)
+		}
+		if style, ok := tc.theme.levels[log.severity]; ok {
+			applyStyle(cell, style)
+		}
+	case "timestamp":
+		cell.SetText(tc.time.format(log.timestamp, time.Now()))
+	case "delta":
+		// logs are sorted newest first, so the previous log is the next row
+		if row+1 < len(tc.logs) {
+			cell.SetText(formatDelta(log.timestamp.Sub(tc.logs[row+1].timestamp)))
+			cell.SetAlign(tview.AlignRight)
+		}
+	case "message":
 		cell.SetText(log.message)
 		cell.SetMaxWidth(80)
 		cell.SetExpansion(1)
 	default:
-		v := log.data[tc.columns[col]]
+		v := log.data[column[1:]]
 		if v != nil {
 			cell.SetText(fmt.Sprint(v))
 		}
 	}
+	if style, ok := matchRules(tc.rules, &log); ok {
+		applyStyle(cell, style)
+	}
+	if log.id == tc.highlightId {
+		cell.SetAttributes(cell.Attributes | tcell.AttrBold | tcell.AttrUnderline)
+	}
 	return cell
 }
 
@@ -193,5 +1391,5 @@ func (tc *tableContent) GetRowCount() int {
 }
 
 func (tc *tableContent) GetColumnCount() int {
-	return len(tc.columns) + 3
+	return len(tc.columns) + len(tc.fixedColumns())
 }
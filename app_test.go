@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetContentCell(t *testing.T) {
+	rules, err := newHighlightRules([]highlightRuleConfig{{Match: "status>=500", Background: "yellow"}}, themes["dark"])
+	assert.NoError(t, err)
+	tc := tableContent{
+		logs: []log{
+			{id: 1, level: "error", severity: severityError, data: map[string]any{"status": float64(502)}},
+			{id: 2, level: "info", severity: severityInfo},
+		},
+		theme:       themes["dark"],
+		rules:       rules,
+		highlightId: 2,
+	}
+
+	assert.Equal(t, tcell.ColorYellow, tc.getContentCell(0, "level").BackgroundColor)
+
+	attr := tc.getContentCell(1, "level").Attributes
+	assert.NotZero(t, attr&tcell.AttrBold)
+	assert.NotZero(t, attr&tcell.AttrUnderline)
+}
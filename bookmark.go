@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// bookmark is a marked log.
+type bookmark struct {
+	created time.Time
+	log     log
+}
+
+// toggleBookmark marks the log with the given row id, or unmarks it if it is
+// already marked. It returns whether the log is now marked.
+func (db *DB) toggleBookmark(id int64) (bool, error) {
+	result, err := db.sqlDB.Exec("DELETE FROM bookmarks WHERE log_id = ?", id)
+	if err != nil {
+		return false, fmt.Errorf("couldn't remove bookmark: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return false, nil
+	}
+
+	_, err = db.sqlDB.Exec(
+		"INSERT INTO bookmarks(log_id, created) VALUES (?, ?)",
+		id,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("couldn't add bookmark: %w", err)
+	}
+	return true, nil
+}
+
+// setBookmarkNote sets the note of a bookmark, marking the log if needed.
+func (db *DB) setBookmarkNote(id int64, note string) error {
+	_, err := db.sqlDB.Exec(
+		"INSERT INTO bookmarks(log_id, note, created) VALUES (?, ?, ?)"+
+			" ON CONFLICT(log_id) DO UPDATE SET note = excluded.note",
+		id,
+		note,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("couldn't set bookmark note: %w", err)
+	}
+	return nil
+}
+
+// queryBookmarks returns the marked logs, newest first.
+func (db *DB) queryBookmarks() ([]bookmark, error) {
+	slog.Info("querying bookmarks")
+	rows, err := db.sqlDB.Query("SELECT " + logColumns + ", bookmarks.created" +
+		" FROM logs JOIN bookmarks ON bookmarks.log_id = logs.rowid" +
+		" ORDER BY logs.timestamp DESC",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bookmarks: %w", err)
+	}
+	defer rows.Close()
+
+	bookmarks := []bookmark{}
+	for rows.Next() {
+		var b bookmark
+		b.log, err = scanLog(rows, &b.created)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan bookmark: %w", err)
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query bookmarks: %w", err)
+	}
+	return bookmarks, nil
+}
+
+// writeBookmarks exports the bookmarks to the file at path.
+func writeBookmarks(path string, bookmarks []bookmark) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("couldn't create export file: %w", err)
+	}
+	err = exportBookmarks(f, bookmarks)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("couldn't write export file: %w", closeErr)
+	}
+	return err
+}
+
+// bookmarkJSON is a bookmark as exported, one per line.
+type bookmarkJSON struct {
+	Note    string         `json:"note"`
+	Created time.Time      `json:"created"`
+	Log     map[string]any `json:"log"`
+}
+
+// exportBookmarks writes the bookmarks as JSON lines, with their note and the
+// marked log.
+func exportBookmarks(w io.Writer, bookmarks []bookmark) error {
+	enc := json.NewEncoder(w)
+	for _, b := range bookmarks {
+		err := enc.Encode(bookmarkJSON{Note: b.log.note, Created: b.created, Log: b.log.data})
+		if err != nil {
+			return fmt.Errorf("couldn't export bookmark: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBookmarks(t *testing.T) {
+	db := testOpenDatabase(t)
+	start := time.Date(2023, time.July, 24, 18, 34, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		logJSON := fmt.Sprintf(`{"timestamp":"%s","level":"info","msg":"log %d"}`,
+			start.Add(time.Duration(i)*time.Second).Format(time.RFC3339), i)
+		assert.NoError(t, db.appendLog([]byte(logJSON)))
+	}
+
+	marked, err := db.toggleBookmark(1)
+	assert.NoError(t, err)
+	assert.True(t, marked)
+	marked, err = db.toggleBookmark(2)
+	assert.NoError(t, err)
+	assert.True(t, marked)
+	marked, err = db.toggleBookmark(2)
+	assert.NoError(t, err)
+	assert.False(t, marked)
+	assert.NoError(t, db.setBookmarkNote(3, "first failure"))
+
+	logs, err := db.queryLogs(time.Time{}, time.Now())
+	assert.NoError(t, err)
+	if assert.Len(t, logs, 3) {
+		assert.True(t, logs[0].marked)
+		assert.Equal(t, "first failure", logs[0].note)
+		assert.False(t, logs[1].marked)
+		assert.True(t, logs[2].marked)
+		assert.Equal(t, "", logs[2].note)
+	}
+
+	bookmarks, err := db.queryBookmarks()
+	assert.NoError(t, err)
+	if !assert.Len(t, bookmarks, 2) {
+		return
+	}
+	assert.Equal(t, int64(3), bookmarks[0].log.id)
+	assert.Equal(t, int64(1), bookmarks[1].log.id)
+	assert.Equal(t, "log 0", bookmarks[1].log.message)
+	assert.WithinDuration(t, time.Now(), bookmarks[0].created, time.Minute)
+
+	bookmarks[0].created = start
+	bookmarks[1].created = start
+	buf := bytes.Buffer{}
+	assert.NoError(t, exportBookmarks(&buf, bookmarks))
+	assert.Equal(
+		t,
+		`{"note":"first failure","created":"2023-07-24T18:34:00Z",`+
+			`"log":{"level":"info","msg":"log 2","timestamp":"2023-07-24T18:34:02Z"}}`+"\n"+
+			`{"note":"","created":"2023-07-24T18:34:00Z",`+
+			`"log":{"level":"info","msg":"log 0","timestamp":"2023-07-24T18:34:00Z"}}`+"\n",
+		buf.String(),
+	)
+}
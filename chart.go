@@ -0,0 +1,360 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// histogramBins is the number of bars of the histogram.
+	histogramBins = 16
+	// histogramWidth is the length of the longest bar of the histogram.
+	histogramWidth = 50
+	// chartBuckets is the number of time buckets of the percentile chart.
+	chartBuckets = 60
+	// chartHeight is the number of rows of each percentile chart.
+	chartHeight = 4
+)
+
+// chartScope selects the logs a chart is computed on: those between from and
+// to and, if ids isn't nil, with one of the row ids.
+type chartScope struct {
+	from time.Time
+	to   time.Time
+	ids  []int64
+}
+
+// numericStats summarizes the numeric values of a field.
+type numericStats struct {
+	count    int
+	min, max float64
+	first    time.Time
+	last     time.Time
+}
+
+// histogramBin counts the values between from (included) and to (excluded,
+// except for the last bin).
+type histogramBin struct {
+	from, to float64
+	count    int
+}
+
+// percentileBucket holds the percentiles of the values of a time bucket.
+type percentileBucket struct {
+	time          time.Time
+	count         int
+	p50, p90, p99 float64
+}
+
+// numericValuesSQL selects the timestamp and numeric value of a field of the
+// logs in scope. Strings holding a JSON number, which fieldNumber parses too,
+// are converted; others such as "2023-07-24" or "10.0.0.1" are not numbers.
+func numericValuesSQL(field string, scope chartScope) string {
+	query := "WITH field_paths AS (" +
+		"SELECT logs.timestamp AS timestamp, logs.data AS data, " +
+		fieldPathSQL("logs.data", len(jsonPaths(field))) + " AS path" +
+		" FROM logs WHERE logs.timestamp BETWEEN :from AND :to"
+	if scope.ids != nil {
+		query += " AND logs.rowid IN (SELECT value FROM json_each(:ids))"
+	}
+	return query + "), field_values AS (" +
+		"SELECT timestamp, json_type(data, path) AS type, json_extract(data, path) AS raw" +
+		" FROM field_paths" +
+		"), numeric_values AS (" +
+		"SELECT timestamp, CASE" +
+		" WHEN type IN ('integer', 'real') THEN raw" +
+		" WHEN type = 'text' AND json_valid(raw) THEN CASE" +
+		" WHEN trim(raw) = raw AND json_type(raw) IN ('integer', 'real') THEN CAST(raw AS REAL)" +
+		" END" +
+		" END AS value" +
+		" FROM field_values" +
+		") "
+}
+
+// chartArgs returns the parameters of numericValuesSQL.
+func chartArgs(field string, scope chartScope) ([]any, error) {
+	args := append(
+		fieldPathArgs(jsonPaths(field)),
+		sql.Named("from", scope.from),
+		sql.Named("to", scope.to),
+	)
+	if scope.ids != nil {
+		ids, err := json.Marshal(scope.ids)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't encode log ids: %w", err)
+		}
+		args = append(args, sql.Named("ids", string(ids)))
+	}
+	return args, nil
+}
+
+// queryNumericStats returns the count, range and time span of the numeric
+// values of a field.
+func (db *DB) queryNumericStats(field string, scope chartScope) (numericStats, error) {
+	slog.Info("querying numeric stats", "field", field, "from", scope.from, "to", scope.to)
+	var stats numericStats
+	args, err := chartArgs(field, scope)
+	if err != nil {
+		return stats, err
+	}
+
+	var min, max sql.NullFloat64
+	var first, last any
+	err = db.sqlDB.QueryRow(
+		numericValuesSQL(field, scope)+
+			"SELECT COUNT(value), MIN(value), MAX(value), MIN(timestamp), MAX(timestamp)"+
+			" FROM numeric_values WHERE value IS NOT NULL",
+		args...,
+	).Scan(&stats.count, &min, &max, &first, &last)
+	if err != nil {
+		return stats, fmt.Errorf("failed to query numeric stats: %w", err)
+	}
+	if stats.count == 0 {
+		return stats, nil
+	}
+	stats.min, stats.max = min.Float64, max.Float64
+	stats.first, err = sqliteTime(first)
+	if err != nil {
+		return stats, fmt.Errorf("failed to query numeric stats: %w", err)
+	}
+	stats.last, err = sqliteTime(last)
+	if err != nil {
+		return stats, fmt.Errorf("failed to query numeric stats: %w", err)
+	}
+	return stats, nil
+}
+
+// queryHistogram counts the numeric values of a field in bins equal parts of
+// the range of stats.
+func (db *DB) queryHistogram(field string, scope chartScope, stats numericStats, bins int) ([]histogramBin, error) {
+	slog.Info("querying histogram", "field", field, "from", scope.from, "to", scope.to)
+	width := (stats.max - stats.min) / float64(bins)
+	histogram := make([]histogramBin, bins)
+	for i := range histogram {
+		histogram[i].from = stats.min + float64(i)*width
+		histogram[i].to = stats.min + float64(i+1)*width
+	}
+	if width == 0 {
+		// a single value
+		histogram = histogram[:1]
+		histogram[0].count = stats.count
+		return histogram, nil
+	}
+
+	args, err := chartArgs(field, scope)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, sql.Named("min", stats.min), sql.Named("width", width), sql.Named("last", bins-1))
+	rows, err := db.sqlDB.Query(
+		numericValuesSQL(field, scope)+
+			"SELECT MIN(CAST((value - :min) / :width AS INTEGER), :last) AS bin, COUNT(*)"+
+			" FROM numeric_values WHERE value IS NOT NULL"+
+			" GROUP BY bin",
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query histogram: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bin, count int
+		err := rows.Scan(&bin, &count)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan histogram: %w", err)
+		}
+		if bin >= 0 && bin < bins {
+			histogram[bin].count = count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query histogram: %w", err)
+	}
+	return histogram, nil
+}
+
+// queryPercentiles returns the 50th, 90th and 99th nearest-rank percentiles of
+// the numeric values of a field for each time bucket of the given size.
+// Buckets without values are omitted.
+func (db *DB) queryPercentiles(field string, scope chartScope, bucket time.Duration) ([]percentileBucket, error) {
+	slog.Info("querying percentiles", "field", field, "from", scope.from, "to", scope.to, "bucket", bucket)
+	args, err := chartArgs(field, scope)
+	if err != nil {
+		return nil, err
+	}
+	seconds := int64(bucket / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	args = append(args, sql.Named("bucket", seconds))
+	rows, err := db.sqlDB.Query(
+		numericValuesSQL(field, scope)+
+			", bucketed AS ("+
+			"SELECT CAST(strftime('%s', timestamp) AS INTEGER) / :bucket AS bucket, value"+
+			" FROM numeric_values WHERE value IS NOT NULL"+
+			"), ranked AS ("+
+			"SELECT bucket, value,"+
+			" ROW_NUMBER() OVER (PARTITION BY bucket ORDER BY value) AS position,"+
+			" COUNT(*) OVER (PARTITION BY bucket) AS total"+
+			" FROM bucketed"+
+			") SELECT bucket, MAX(total),"+
+			" MIN(CASE WHEN position >= 0.5 * total THEN value END),"+
+			" MIN(CASE WHEN position >= 0.9 * total THEN value END),"+
+			" MIN(CASE WHEN position >= 0.99 * total THEN value END)"+
+			" FROM ranked GROUP BY bucket ORDER BY bucket",
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query percentiles: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := []percentileBucket{}
+	for rows.Next() {
+		var index int64
+		var b percentileBucket
+		err := rows.Scan(&index, &b.count, &b.p50, &b.p90, &b.p99)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan percentiles: %w", err)
+		}
+		b.time = time.Unix(index*seconds, 0).UTC()
+		buckets = append(buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query percentiles: %w", err)
+	}
+	return buckets, nil
+}
+
+// chartBucketSize returns the size, in whole seconds, of the time buckets
+// dividing the span of stats in at most chartBuckets buckets.
+func chartBucketSize(stats numericStats) time.Duration {
+	size := stats.last.Sub(stats.first) / (chartBuckets - 1)
+	return size.Truncate(time.Second) + time.Second
+}
+
+// bucketStart returns the start of the time bucket of t. Buckets are aligned
+// on the Unix epoch, as in queryPercentiles.
+func bucketStart(t time.Time, size time.Duration) time.Time {
+	seconds := int64(size / time.Second)
+	return time.Unix(t.Unix()/seconds*seconds, 0).UTC()
+}
+
+// eighthBlocks are the characters of horizontal bars, from 1/8 to a full
+// block.
+var eighthBlocks = []rune("▏▎▍▌▋▊▉█")
+
+// drawHistogram draws a horizontal bar for each bin, with its range and count.
+func drawHistogram(histogram []histogramBin) string {
+	highest := 0
+	for _, b := range histogram {
+		if b.count > highest {
+			highest = b.count
+		}
+	}
+
+	builder := strings.Builder{}
+	for _, b := range histogram {
+		fmt.Fprintf(&builder, "%12s - %-12s %8d ", formatStat(b.from), formatStat(b.to), b.count)
+		if highest > 0 {
+			eighths := b.count * histogramWidth * 8 / highest
+			builder.WriteString(strings.Repeat(string(eighthBlocks[7]), eighths/8))
+			if eighths%8 > 0 {
+				builder.WriteRune(eighthBlocks[eighths%8-1])
+			}
+		}
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// drawColumns draws values as columns height rows high, scaled so that lowest
+// is the bottom and highest fills a column, and returns the rows from top to
+// bottom. NaN values are blank columns, and other values are at least an
+// eighth of a row high.
+func drawColumns(values []float64, lowest, highest float64, height int) []string {
+	rows := make([]strings.Builder, height)
+	for _, v := range values {
+		eighths := 0
+		if !math.IsNaN(v) && highest > lowest {
+			eighths = int(math.Round((v - lowest) / (highest - lowest) * float64(height*8)))
+			if eighths < 1 {
+				eighths = 1
+			}
+		}
+		for i := range rows {
+			// rows are filled from the bottom
+			fill := eighths - (height-1-i)*8
+			switch {
+			case fill >= 8:
+				rows[i].WriteRune(sparkBlocks[7])
+			case fill > 0:
+				rows[i].WriteRune(sparkBlocks[fill-1])
+			default:
+				rows[i].WriteRune(' ')
+			}
+		}
+	}
+	lines := make([]string, height)
+	for i := range rows {
+		lines[i] = rows[i].String()
+	}
+	return lines
+}
+
+// drawPercentiles draws a column chart of each percentile over time, with the
+// same scale, from start in buckets of the given size. The scale starts at 0,
+// or at the lowest value if it is negative.
+func drawPercentiles(buckets []percentileBucket, start time.Time, size time.Duration, tf func(time.Time) string) string {
+	start = bucketStart(start, size)
+	p50 := make([]float64, chartBuckets)
+	p90 := make([]float64, chartBuckets)
+	p99 := make([]float64, chartBuckets)
+	for i := range p50 {
+		// buckets without values
+		p50[i], p90[i], p99[i] = math.NaN(), math.NaN(), math.NaN()
+	}
+	lowest, highest := 0.0, 0.0
+	for _, b := range buckets {
+		i := int(b.time.Sub(start) / size)
+		if i < 0 || i >= chartBuckets {
+			continue
+		}
+		p50[i], p90[i], p99[i] = b.p50, b.p90, b.p99
+		lowest = math.Min(lowest, b.p50)
+		highest = math.Max(highest, b.p99)
+	}
+
+	builder := strings.Builder{}
+	for _, series := range []struct {
+		name   string
+		values []float64
+	}{{"p99", p99}, {"p90", p90}, {"p50", p50}} {
+		for i, line := range drawColumns(series.values, lowest, highest, chartHeight) {
+			label := ""
+			switch i {
+			case 0:
+				label = series.name + " " + formatStat(highest)
+			case chartHeight - 1:
+				label = formatStat(lowest)
+			}
+			fmt.Fprintf(&builder, "%14s │%s\n", label, line)
+		}
+		builder.WriteString("\n")
+	}
+
+	left, right := tf(start), tf(start.Add(size*chartBuckets))
+	padding := chartBuckets - len([]rune(left)) - len([]rune(right))
+	if padding < 1 {
+		padding = 1
+	}
+	fmt.Fprintf(&builder, "%14s  %s%s%s  (%s buckets)\n", "", left, strings.Repeat(" ", padding), right, size)
+	return builder.String()
+}
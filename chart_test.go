@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testChartDatabase(t *testing.T) (*DB, time.Time) {
+	db := testOpenDatabase(t)
+	start := time.Date(2023, time.July, 24, 18, 34, 0, 0, time.UTC)
+	// 1 to 100 in the first minute, 101 to 200 in the second, with a
+	// numeric string, a missing value and a text value
+	for i := 1; i <= 200; i++ {
+		logJSON := fmt.Sprintf(`{"timestamp":"%s","latency":%d}`,
+			start.Add(time.Duration(i-1)*600*time.Millisecond).Format(time.RFC3339Nano), i)
+		if i == 150 {
+			logJSON = fmt.Sprintf(`{"timestamp":"%s","latency":"150"}`,
+				start.Add(149*600*time.Millisecond).Format(time.RFC3339Nano))
+		}
+		assert.NoError(t, db.appendLog([]byte(logJSON)))
+	}
+	assert.NoError(t, db.appendLog([]byte(`{"timestamp":"2023-07-24T18:36:00Z","msg":"no latency"}`)))
+	assert.NoError(t, db.appendLog([]byte(`{"timestamp":"2023-07-24T18:36:00Z","latency":"slow"}`)))
+	return db, start
+}
+
+func TestQueryNumericStats(t *testing.T) {
+	db, start := testChartDatabase(t)
+	scope := chartScope{to: time.Now()}
+
+	stats, err := db.queryNumericStats("latency", scope)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, stats.count)
+	assert.Equal(t, 1.0, stats.min)
+	assert.Equal(t, 200.0, stats.max)
+	assert.True(t, stats.first.Equal(start))
+	assert.True(t, stats.last.Equal(start.Add(199*600*time.Millisecond)))
+
+	stats, err = db.queryNumericStats("latency", chartScope{to: time.Now(), ids: []int64{3, 5, 201}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.count)
+	assert.Equal(t, 3.0, stats.min)
+	assert.Equal(t, 5.0, stats.max)
+
+	stats, err = db.queryNumericStats("latency", chartScope{from: start.Add(time.Minute), to: time.Now()})
+	assert.NoError(t, err)
+	assert.Equal(t, 100, stats.count)
+	assert.Equal(t, 101.0, stats.min)
+
+	stats, err = db.queryNumericStats("msg", scope)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.count)
+}
+
+func TestQueryNumericStatsStrings(t *testing.T) {
+	db := testOpenDatabase(t)
+	values := []string{`"42"`, `"-1.5"`, `"1e3"`, `7`, `"2023-07-24"`, `"10.0.0.1"`, `"1-2"`, `" 42"`, `"abc"`, `true`}
+	for i, v := range values {
+		logJSON := fmt.Sprintf(`{"timestamp":"2023-07-24T18:34:%02dZ","value":%s}`, i, v)
+		assert.NoError(t, db.appendLog([]byte(logJSON)))
+	}
+
+	// the values the fields page counts as numbers
+	numbers := 0
+	for _, s := range db.fields.summaries() {
+		if s.name == "value" {
+			numbers = s.numbers
+		}
+	}
+	assert.Equal(t, 4, numbers)
+
+	stats, err := db.queryNumericStats("value", chartScope{to: time.Now()})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, stats.count)
+	assert.Equal(t, -1.5, stats.min)
+	assert.Equal(t, 1000.0, stats.max)
+}
+
+func TestDrawPercentilesNegative(t *testing.T) {
+	start := time.Date(2023, time.July, 24, 18, 34, 0, 0, time.UTC)
+	text := drawPercentiles(
+		[]percentileBucket{{time: start, count: 2, p50: -10, p90: -5, p99: 5}},
+		start,
+		time.Second,
+		func(t time.Time) string { return t.Format(time.TimeOnly) },
+	)
+	assert.Contains(t, text, "p99 5 │")
+	assert.Contains(t, text, "-10 │")
+	assert.NotContains(t, text, " 0 │")
+}
+
+func TestQueryHistogram(t *testing.T) {
+	db, _ := testChartDatabase(t)
+	scope := chartScope{to: time.Now()}
+	stats, err := db.queryNumericStats("latency", scope)
+	assert.NoError(t, err)
+
+	histogram, err := db.queryHistogram("latency", scope, stats, 4)
+	assert.NoError(t, err)
+	if assert.Len(t, histogram, 4) {
+		assert.Equal(t, 1.0, histogram[0].from)
+		assert.Equal(t, 200.0, histogram[3].to)
+		total := 0
+		for _, b := range histogram {
+			assert.InDelta(t, 50, b.count, 1)
+			total += b.count
+		}
+		assert.Equal(t, 200, total)
+	}
+
+	stats, err = db.queryNumericStats("latency", chartScope{to: time.Now(), ids: []int64{7}})
+	assert.NoError(t, err)
+	histogram, err = db.queryHistogram("latency", chartScope{to: time.Now(), ids: []int64{7}}, stats, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, []histogramBin{{from: 7, to: 7, count: 1}}, histogram)
+}
+
+func TestQueryPercentiles(t *testing.T) {
+	db, start := testChartDatabase(t)
+	scope := chartScope{to: time.Now()}
+
+	buckets, err := db.queryPercentiles("latency", scope, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []percentileBucket{
+		{time: start.Truncate(time.Minute), count: 100, p50: 50, p90: 90, p99: 99},
+		{time: start.Truncate(time.Minute).Add(time.Minute), count: 100, p50: 150, p90: 190, p99: 199},
+	}, buckets)
+}
+
+func TestChartBucketSize(t *testing.T) {
+	start := time.Date(2023, time.July, 24, 18, 34, 0, 0, time.UTC)
+	assert.Equal(t, time.Second, chartBucketSize(numericStats{first: start, last: start}))
+	assert.Equal(t, 2*time.Second, chartBucketSize(numericStats{first: start, last: start.Add(time.Minute)}))
+	assert.Equal(t, time.Minute, bucketStart(start.Add(90*time.Second), time.Minute).Sub(start))
+}
+
+func TestDrawColumns(t *testing.T) {
+	assert.Equal(t, []string{
+		"  ▄█",
+		"▁▄██",
+	}, drawColumns([]float64{0, 1, 3, 4}, 0, 4, 2))
+	assert.Equal(t, []string{"▁▄█ "}, drawColumns([]float64{-2, 0, 2, math.NaN()}, -2, 2, 1))
+	assert.Equal(t, []string{"  "}, drawColumns([]float64{0, 0}, 0, 0, 1))
+}
+
+func TestDrawHistogram(t *testing.T) {
+	text := drawHistogram([]histogramBin{{from: 0, to: 5, count: 10}, {from: 5, to: 10, count: 1}})
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.True(t, strings.HasSuffix(lines[0], " 10 "+strings.Repeat("█", histogramWidth)))
+		assert.True(t, strings.HasSuffix(lines[1], " 1 "+strings.Repeat("█", histogramWidth/10)))
+		assert.Contains(t, lines[1], "5 - 10")
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// childProcess runs a command and appends its output to the database. Lines
+// from stdout and stderr are tagged with their stream in the "source" field.
+type childProcess struct {
+	args []string
+	db   *DB
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	state    *os.ProcessState
+	done     chan struct{}
+	restarts int
+}
+
+func newChildProcess(args []string, db *DB) *childProcess {
+	return &childProcess{args: args, db: db}
+}
+
+// start runs the command. It fails if the command is already running.
+func (p *childProcess) start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.running() {
+		return fmt.Errorf("%s is already running", p.args[0])
+	}
+
+	cmd := exec.Command(p.args[0], p.args[1:]...)
+	// the command runs in its own process group, so that kill terminates
+	// the processes it started too
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("couldn't open stdout: %w", err)
+	}
+	stderr, stderrWriter, err := os.Pipe()
+	if err != nil {
+		stdout.Close()
+		stdoutWriter.Close()
+		return fmt.Errorf("couldn't open stderr: %w", err)
+	}
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+
+	slog.Info("starting command", "args", p.args)
+	err = cmd.Start()
+	// the command has its own copies of the write ends
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	if err != nil {
+		stdout.Close()
+		stderr.Close()
+		return fmt.Errorf("couldn't start %s: %w", p.args[0], err)
+	}
+	if p.cmd != nil {
+		p.restarts++
+	}
+	p.cmd = cmd
+	p.state = nil
+	p.done = make(chan struct{})
+
+	go p.wait(cmd, p.done, stdout, stderr)
+	return nil
+}
+
+// outputDrainTimeout is how long wait keeps reading the output of the command
+// after it exited. Processes that left its process group, such as daemons,
+// may hold the output open indefinitely.
+const outputDrainTimeout = 2 * time.Second
+
+// wait waits for cmd to exit, and reads its output until both streams are
+// closed, or for at most outputDrainTimeout after it exited.
+func (p *childProcess) wait(cmd *exec.Cmd, done chan struct{}, stdout, stderr *os.File) {
+	scanned := make(chan struct{})
+	go func() {
+		wg := sync.WaitGroup{}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			p.scan(stdout, "stdout")
+		}()
+		go func() {
+			defer wg.Done()
+			p.scan(stderr, "stderr")
+		}()
+		wg.Wait()
+		close(scanned)
+	}()
+
+	err := cmd.Wait()
+	slog.Info("command exited", "args", p.args, "error", err)
+
+	select {
+	case <-scanned:
+	case <-time.After(outputDrainTimeout):
+		slog.Warn("closing command output still held open", "args", p.args)
+		// closing the pipes ends the scans
+		stdout.Close()
+		stderr.Close()
+		<-scanned
+	}
+	stdout.Close()
+	stderr.Close()
+
+	p.mu.Lock()
+	p.state = cmd.ProcessState
+	p.mu.Unlock()
+	close(done)
+}
+
+func (p *childProcess) scan(r io.Reader, source string) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, bufio.MaxScanTokenSize*16)
+	fields := map[string]any{"source": source}
+	for scanner.Scan() {
+		err := appendLine(p.db, textToJSON(scanner.Bytes()), fields)
+		if err != nil {
+			slog.Warn("couldn't append log", "source", source, "error", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		slog.Warn("couldn't read command output", "source", source, "error", err)
+	}
+}
+
+// textToJSON wraps lines that are neither JSON objects nor syslog messages in
+// a JSON object, as the message.
+func textToJSON(line []byte) []byte {
+	trimmed := strings.TrimSpace(string(line))
+	if strings.HasPrefix(trimmed, "{") || isSyslog([]byte(trimmed)) || trimmed == "" {
+		return line
+	}
+	logJSON, _ := json.Marshal(map[string]any{"msg": string(line)})
+	return logJSON
+}
+
+// running must be called with p.mu held.
+func (p *childProcess) running() bool {
+	return p.cmd != nil && p.state == nil
+}
+
+// killTimeout is how long kill waits for the command to terminate before
+// killing it forcefully.
+const killTimeout = 5 * time.Second
+
+// kill asks the command and the processes it started to terminate, and
+// waits for it to exit.
+func (p *childProcess) kill() error {
+	p.mu.Lock()
+	if !p.running() {
+		p.mu.Unlock()
+		return nil
+	}
+	pid, done := p.cmd.Process.Pid, p.done
+	p.mu.Unlock()
+
+	slog.Info("terminating command", "args", p.args)
+	// a negative pid signals the process group
+	err := syscall.Kill(-pid, syscall.SIGTERM)
+	if err != nil && !errors.Is(err, syscall.ESRCH) {
+		err = syscall.Kill(-pid, syscall.SIGKILL)
+		if err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("couldn't kill %s: %w", p.args[0], err)
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(killTimeout):
+		slog.Warn("killing command", "args", p.args)
+		syscall.Kill(-pid, syscall.SIGKILL)
+		<-done
+	}
+	return nil
+}
+
+// commandWaitDelay is how long Wait waits for the output of a command killed
+// by its context, which processes outside its group may hold open.
+const commandWaitDelay = time.Second
+
+// shellCommand returns a command running command with the shell, in its own
+// process group. The whole group is killed when ctx is done.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = commandWaitDelay
+	return cmd
+}
+
+// restart kills the command if it is running, then starts it again.
+func (p *childProcess) restart() error {
+	err := p.kill()
+	if err != nil {
+		return err
+	}
+	return p.start()
+}
+
+// status describes the state of the command for the header, e.g.
+// "myservice: running (pid 1234)" or "myservice: exited (exit status 1)".
+func (p *childProcess) status() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	text := p.args[0] + ": "
+	switch {
+	case p.cmd == nil:
+		text += "not started"
+	case p.state == nil:
+		text += fmt.Sprintf("running (pid %d)", p.cmd.Process.Pid)
+	default:
+		text += fmt.Sprintf("exited (%s)", p.state)
+	}
+	if p.restarts > 0 {
+		text += fmt.Sprintf(", %d restarts", p.restarts)
+	}
+	return text
+}
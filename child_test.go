@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testShell(t *testing.T) string {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+	return sh
+}
+
+func testWaitStatus(t *testing.T, p *childProcess, substr string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(p.status(), substr) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected status to contain %q, got %q", substr, p.status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestChildProcessOutput(t *testing.T) {
+	sh := testShell(t)
+	db := testOpenDatabase(t)
+
+	p := newChildProcess([]string{
+		sh, "-c", `echo '{"level":"info","msg":"json line"}'; echo 'plain line' >&2; exit 3`,
+	}, db)
+	assert.Contains(t, p.status(), "not started")
+	assert.NoError(t, p.start())
+
+	logs := testWaitLogs(t, db, 2)
+	sources := map[string]string{}
+	for _, l := range logs {
+		sources[l.message] = l.data["source"].(string)
+	}
+	assert.Equal(t, map[string]string{"json line": "stdout", "plain line": "stderr"}, sources)
+
+	testWaitStatus(t, p, "exited (exit status 3)")
+}
+
+func TestChildProcessRestartAndKill(t *testing.T) {
+	sh := testShell(t)
+	db := testOpenDatabase(t)
+
+	p := newChildProcess([]string{sh, "-c", "echo started; exec sleep 10"}, db)
+	assert.NoError(t, p.start())
+	testWaitStatus(t, p, "running (pid ")
+	testWaitLogs(t, db, 1)
+	assert.Error(t, p.start())
+
+	assert.NoError(t, p.restart())
+	testWaitStatus(t, p, ", 1 restarts")
+	testWaitLogs(t, db, 2)
+
+	assert.NoError(t, p.kill())
+	assert.Contains(t, p.status(), "exited (signal: terminated)")
+	assert.NoError(t, p.kill())
+}
+
+func TestChildProcessKillGroup(t *testing.T) {
+	sh := testShell(t)
+	db := testOpenDatabase(t)
+
+	// the pipeline holds stdout open after sh is killed
+	p := newChildProcess([]string{sh, "-c", "echo started; sleep 30 | cat"}, db)
+	assert.NoError(t, p.start())
+	testWaitLogs(t, db, 1)
+
+	start := time.Now()
+	assert.NoError(t, p.kill())
+	assert.Less(t, time.Since(start), killTimeout)
+	assert.Contains(t, p.status(), "exited")
+}
+
+func TestChildProcessOutputHeldOpen(t *testing.T) {
+	sh := testShell(t)
+	if _, err := exec.LookPath("setsid"); err != nil {
+		t.Skip("setsid is not available")
+	}
+	db := testOpenDatabase(t)
+
+	// the daemon leaves the process group and keeps stdout open after sh
+	// exited
+	p := newChildProcess([]string{sh, "-c", "echo started; setsid sleep 4 &"}, db)
+	assert.NoError(t, p.start())
+	testWaitStatus(t, p, "exited (exit status 0)")
+	assert.Len(t, testWaitLogs(t, db, 1), 1)
+}
+
+func TestShellCommandTimeout(t *testing.T) {
+	testShell(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// the pipeline holds the output open after sh is killed
+	start := time.Now()
+	_, err := shellCommand(ctx, "sleep 30 | cat").CombinedOutput()
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), commandWaitDelay+time.Second)
+}
+
+func TestTextToJSON(t *testing.T) {
+	assert.Equal(t, `{"msg":"hello \"world\""}`, string(textToJSON([]byte(`hello "world"`))))
+	assert.Equal(t, `{"a":1}`, string(textToJSON([]byte(`{"a":1}`))))
+	assert.Equal(t, "<14>hello", string(textToJSON([]byte("<14>hello"))))
+}
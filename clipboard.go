@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// clipboardTool is a command that copies its standard input to the system
+// clipboard, used when env is set.
+type clipboardTool struct {
+	env  string
+	name string
+	args []string
+}
+
+// clipboardTools are tried in order when OSC 52 isn't available.
+var clipboardTools = []clipboardTool{
+	{env: "WAYLAND_DISPLAY", name: "wl-copy"},
+	{env: "DISPLAY", name: "xclip", args: []string{"-selection", "clipboard"}},
+}
+
+// clipboardTimeout is how long a clipboard tool can run, e.g. when the X
+// server is unreachable.
+const clipboardTimeout = 2 * time.Second
+
+// errNoClipboardTool is returned by copyWithTool when no tool is available.
+var errNoClipboardTool = errors.New("no clipboard tool available")
+
+// copyWithTool copies text to the system clipboard with the first clipboard
+// tool available. It waits for the tool for at most clipboardTimeout, so it
+// must not run on the UI goroutine.
+func copyWithTool(text string) error {
+	for _, tool := range clipboardTools {
+		if os.Getenv(tool.env) == "" {
+			continue
+		}
+		path, err := exec.LookPath(tool.name)
+		if err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), clipboardTimeout)
+		defer cancel()
+		// clipboard tools fork to serve the clipboard in the background,
+		// after reading their input
+		cmd := exec.CommandContext(ctx, path, tool.args...)
+		cmd.Stdin = strings.NewReader(text)
+		cmd.WaitDelay = commandWaitDelay
+		err = cmd.Run()
+		if err != nil {
+			return fmt.Errorf("couldn't run %s: %w", tool.name, err)
+		}
+		return nil
+	}
+	return errNoClipboardTool
+}
+
+// clipboardError returns the error of a copy to the clipboard with OSC 52
+// that failed, and with the clipboard tool used as a fallback.
+func clipboardError(oscErr, toolErr error) error {
+	switch {
+	case toolErr == nil:
+		return nil
+	case errors.Is(toolErr, errNoClipboardTool):
+		return oscErr
+	}
+	return fmt.Errorf("%w; %w", oscErr, toolErr)
+}
+
+// errNoOSC52 is the error of a copy with OSC 52 to a terminal that doesn't
+// support it.
+var errNoOSC52 = errors.New("terminal doesn't support OSC 52")
+
+// osc52Sequence returns the escape sequence copying text with OSC 52, or
+// false when it wouldn't reach the terminal: without TERM, on the Linux
+// console, in GNU screen, or in tmux when neither set-clipboard nor
+// allow-passthrough is on. In tmux, it runs tmuxOption, which can be slow.
+func osc52Sequence(text string, getenv func(string) string, tmuxOption func(string) (string, error)) (string, bool) {
+	switch getenv("TERM") {
+	case "", "dumb", "linux":
+		return "", false
+	}
+	if getenv("TMUX") == "" {
+		if getenv("STY") != "" {
+			return "", false
+		}
+		return osc52(text, false), true
+	}
+	if v, _ := tmuxOption("set-clipboard"); v == "on" {
+		return osc52(text, false), true
+	}
+	// allow-passthrough was added in tmux 3.3, where it is off by default
+	v, err := tmuxOption("allow-passthrough")
+	if err != nil || v == "on" || v == "all" {
+		return osc52(text, true), true
+	}
+	return "", false
+}
+
+// tmuxOption returns the global value of a tmux option.
+func tmuxOption(name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), clipboardTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "tmux", "show-options", "-gv", name).Output()
+	if err != nil {
+		return "", fmt.Errorf("couldn't get tmux option %s: %w", name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// osc52 returns the escape sequence setting the clipboard to text. In tmux,
+// the sequence is wrapped to be passed through to the terminal.
+func osc52(text string, tmux bool) string {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+	if tmux {
+		return "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	return seq
+}
+
+// writeTerminal writes s to the controlling terminal, which the user interface
+// is drawn on.
+func writeTerminal(s string) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("couldn't open terminal: %w", err)
+	}
+	defer tty.Close()
+	_, err = io.WriteString(tty, s)
+	if err != nil {
+		return fmt.Errorf("couldn't write to terminal: %w", err)
+	}
+	return nil
+}
+
+// fieldText returns a field value as copied: strings as is, other values as
+// JSON.
+func fieldText(v any) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("couldn't encode field: %w", err)
+	}
+	return string(data), nil
+}
+
+// writeLogs writes the JSON of each log on its own line.
+func writeLogs(w io.Writer, logs []log) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, l := range logs {
+		err := enc.Encode(l.data)
+		if err != nil {
+			return fmt.Errorf("couldn't encode log: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOSC52(t *testing.T) {
+	assert.Equal(t, "\x1b]52;c;aGVsbG8=\a", osc52("hello", false))
+	assert.Equal(t, "\x1bPtmux;\x1b\x1b]52;c;aGVsbG8=\a\x1b\\", osc52("hello", true))
+}
+
+func TestFieldText(t *testing.T) {
+	for _, c := range []struct {
+		value  any
+		expect string
+	}{
+		{"GET /users", "GET /users"},
+		{float64(42), "42"},
+		{true, "true"},
+		{nil, "null"},
+		{map[string]any{"id": float64(1)}, `{"id":1}`},
+	} {
+		text, err := fieldText(c.value)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expect, text)
+	}
+}
+
+func TestWriteLogs(t *testing.T) {
+	buf := bytes.Buffer{}
+	err := writeLogs(&buf, []log{
+		{data: map[string]any{"msg": "a <b>", "n": float64(1)}},
+		{data: map[string]any{"msg": "c"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"msg\":\"a <b>\",\"n\":1}\n{\"msg\":\"c\"}\n", buf.String())
+}
+
+func TestCopyWithTool(t *testing.T) {
+	sh := testShell(t)
+	defer func(tools []clipboardTool) { clipboardTools = tools }(clipboardTools)
+	path := filepath.Join(t.TempDir(), "clipboard")
+
+	clipboardTools = []clipboardTool{{env: "LTOP_TEST_CLIPBOARD", name: sh, args: []string{"-c", "cat > " + path}}}
+	assert.ErrorIs(t, copyWithTool("hello"), errNoClipboardTool)
+
+	t.Setenv("LTOP_TEST_CLIPBOARD", "1")
+	assert.NoError(t, copyWithTool("hello"))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// a hung tool is killed
+	clipboardTools[0].args = []string{"-c", "sleep 30"}
+	start := time.Now()
+	assert.Error(t, copyWithTool("hello"))
+	assert.Less(t, time.Since(start), clipboardTimeout+commandWaitDelay+time.Second)
+}
+
+func TestClipboardError(t *testing.T) {
+	oscErr := errors.New("no terminal")
+	toolErr := errors.New("xclip failed")
+	assert.NoError(t, clipboardError(oscErr, nil))
+	assert.Equal(t, oscErr, clipboardError(oscErr, errNoClipboardTool))
+	err := clipboardError(oscErr, toolErr)
+	assert.ErrorIs(t, err, oscErr)
+	assert.ErrorIs(t, err, toolErr)
+}
+
+func TestOSC52Sequence(t *testing.T) {
+	env := map[string]string{}
+	getenv := func(name string) string { return env[name] }
+	options := map[string]string{}
+	tmuxOption := func(name string) (string, error) {
+		v, ok := options[name]
+		if !ok {
+			return "", errors.New("invalid option: " + name)
+		}
+		return v, nil
+	}
+	sequence := func() string {
+		seq, ok := osc52Sequence("hello", getenv, tmuxOption)
+		if !ok {
+			return "unavailable"
+		}
+		return seq
+	}
+
+	assert.Equal(t, "unavailable", sequence())
+	env["TERM"] = "linux"
+	assert.Equal(t, "unavailable", sequence())
+	env["TERM"] = "xterm-256color"
+	assert.Equal(t, osc52("hello", false), sequence())
+	env["STY"] = "1234.pts-0"
+	assert.Equal(t, "unavailable", sequence())
+	delete(env, "STY")
+
+	env["TMUX"] = "/tmp/tmux-1000/default,1234,0"
+	// tmux before 3.3 always passes sequences through
+	assert.Equal(t, osc52("hello", true), sequence())
+	options["allow-passthrough"] = "off"
+	options["set-clipboard"] = "external"
+	assert.Equal(t, "unavailable", sequence())
+	options["allow-passthrough"] = "on"
+	assert.Equal(t, osc52("hello", true), sequence())
+	options["set-clipboard"] = "on"
+	assert.Equal(t, osc52("hello", false), sequence())
+}
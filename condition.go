@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// condition is a boolean expression on a log, such as
+// `status>=500 && msg~timeout`. Comparisons can be combined with && and ||,
+// where && binds tighter. There are no parentheses. Values can be quoted to
+// hold && or ||.
+type condition struct {
+	source string
+	// anyOf holds groups of comparisons; the condition matches if all the
+	// comparisons of at least one group match.
+	anyOf [][]comparison
+}
+
+// comparison compares a log field with a literal value. An empty op tests
+// that the field is present and not null, false, 0 or "".
+type comparison struct {
+	field  string
+	op     string
+	value  string
+	number float64
+	// isNumber is set when value is a number.
+	isNumber bool
+	re       *regexp.Regexp
+	// numericField is set when the field is inferred to hold numbers, so
+	// that its values that aren't numbers don't compare as strings.
+	numericField bool
+}
+
+// comparisonOperators are tried in order, so two-character operators must
+// come first.
+var comparisonOperators = []string{"!=", ">=", "<=", "==", "!~", "=", ">", "<", "~"}
+
+func parseCondition(s string) (*condition, error) {
+	c := condition{source: s}
+	for _, group := range splitCondition(s) {
+		comparisons := []comparison{}
+		for _, clause := range group {
+			cmp, err := parseComparison(clause)
+			if err != nil {
+				return nil, fmt.Errorf("invalid condition \"%s\": %w", s, err)
+			}
+			comparisons = append(comparisons, cmp)
+		}
+		c.anyOf = append(c.anyOf, comparisons)
+	}
+	return &c, nil
+}
+
+// newEqualCondition returns a condition matching the logs where field equals
+// value, a JSON value. It doesn't parse value, which can hold operators.
+func newEqualCondition(field string, value any) *condition {
+	cmp := comparison{field: field, op: "=", value: fieldString(value)}
+	source := strconv.Quote(cmp.value)
+	if n, ok := value.(float64); ok {
+		cmp.number = n
+		cmp.isNumber = true
+		source = cmp.value
+	}
+	return &condition{
+		source: field + " = " + source,
+		anyOf:  [][]comparison{{cmp}},
+	}
+}
+
+// withFieldTypes returns a copy of c comparing the fields for which isNumeric
+// is true as numbers only.
+func (c *condition) withFieldTypes(isNumeric func(field string) bool) *condition {
+	typed := condition{source: c.source, anyOf: make([][]comparison, 0, len(c.anyOf))}
+	for _, group := range c.anyOf {
+		comparisons := append([]comparison{}, group...)
+		for i := range comparisons {
+			comparisons[i].numericField = comparisons[i].isNumber && isNumeric(comparisons[i].field)
+		}
+		typed.anyOf = append(typed.anyOf, comparisons)
+	}
+	return &typed
+}
+
+// splitCondition splits a condition in groups of comparisons at the || and &&
+// operators, except inside quoted values. In unquoted regular expressions,
+// where | and & are common, the operators must follow a space, so that
+// `msg~a||b` is a single comparison.
+func splitCondition(s string) [][]string {
+	groups := [][]string{}
+	clauses := []string{}
+	start := 0
+	// the state of the current comparison
+	var quote byte
+	opSeen, valueStarted, regex := false, false, false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		case regex && ch == '\\':
+			i++
+			continue
+		case (ch == '&' || ch == '|') && i+1 < len(s) && s[i+1] == ch:
+			if regex && valueStarted && s[i-1] != ' ' && s[i-1] != '\t' {
+				i++
+				continue
+			}
+			clauses = append(clauses, s[start:i])
+			if ch == '|' {
+				groups = append(groups, clauses)
+				clauses = []string{}
+			}
+			i++
+			start = i + 1
+			quote, opSeen, valueStarted, regex = 0, false, false, false
+		case !valueStarted && strings.IndexByte("=!<>~", ch) >= 0:
+			opSeen = true
+			regex = regex || ch == '~'
+		case opSeen && !valueStarted && (ch == '"' || ch == '\''):
+			quote = ch
+			valueStarted = true
+		case opSeen && ch != ' ' && ch != '\t':
+			valueStarted = true
+		}
+	}
+	clauses = append(clauses, s[start:])
+	return append(groups, clauses)
+}
+
+func parseComparison(s string) (comparison, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, "=!<>~")
+	if i < 0 {
+		if s == "" {
+			return comparison{}, fmt.Errorf("empty comparison")
+		}
+		return comparison{field: s}, nil
+	}
+
+	cmp := comparison{field: strings.TrimSpace(s[:i])}
+	for _, op := range comparisonOperators {
+		if strings.HasPrefix(s[i:], op) {
+			cmp.op = op
+			break
+		}
+	}
+	if cmp.op == "" {
+		return cmp, fmt.Errorf("invalid operator in \"%s\"", s)
+	}
+	if cmp.field == "" {
+		return cmp, fmt.Errorf("missing field name in \"%s\"", s)
+	}
+
+	value := strings.TrimSpace(s[i+len(cmp.op):])
+	if cmp.op == "==" {
+		cmp.op = "="
+	}
+	if value == "" && cmp.op != "=" && cmp.op != "!=" {
+		return cmp, fmt.Errorf("missing value in \"%s\"", s)
+	}
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	} else if n, err := strconv.ParseFloat(value, 64); err == nil {
+		cmp.number = n
+		cmp.isNumber = true
+	}
+	cmp.value = value
+
+	if cmp.op == "~" || cmp.op == "!~" {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return cmp, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		cmp.re = re
+	}
+	return cmp, nil
+}
+
+func (c *condition) match(l *log) bool {
+	for _, group := range c.anyOf {
+		matched := true
+		for i := range group {
+			if !group[i].match(l) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (cmp *comparison) match(l *log) bool {
+	v, ok := logField(l, cmp.field)
+
+	switch cmp.op {
+	case "":
+		return ok && v != nil && v != false && v != float64(0) && v != ""
+	case "~":
+		return ok && cmp.re.MatchString(fieldString(v))
+	case "!~":
+		return !ok || !cmp.re.MatchString(fieldString(v))
+	}
+
+	if !ok {
+		return cmp.op == "!="
+	}
+
+	var order int
+	if cmp.field == "level" && l.severity != severityNone {
+		// compare levels by severity, e.g. level>=warn
+		_, sev := parseLevel(cmp.value)
+		if sev == severityNone {
+			order = strings.Compare(l.level, cmp.value)
+		} else {
+			order = int(l.severity) - int(sev)
+		}
+	} else if n, isNumber := fieldNumber(v); isNumber && cmp.isNumber {
+		switch {
+		case n < cmp.number:
+			order = -1
+		case n > cmp.number:
+			order = 1
+		}
+	} else if cmp.numericField && cmp.isNumber {
+		// e.g. "n/a" in a numeric field isn't ordered with numbers
+		return cmp.op == "!="
+	} else {
+		order = strings.Compare(fieldString(v), cmp.value)
+	}
+
+	switch cmp.op {
+	case "=":
+		return order == 0
+	case "!=":
+		return order != 0
+	case ">":
+		return order > 0
+	case ">=":
+		return order >= 0
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	}
+	return false
+}
+
+// templateField is the name of the id of a log's message template in
+// conditions. The @ sets it apart from the fields of the logs.
+const templateField = "@template"
+
+// logField returns the value of a field of l. "level" returns the normalized
+// level, "message" or "msg" the message and "@template" the template id; other
+// names are looked up in the log data, where dots descend into nested objects.
+func logField(l *log, name string) (any, bool) {
+	switch name {
+	case "level":
+		return l.level, l.level != ""
+	case "message", "msg":
+		return l.message, true
+	case templateField:
+		return float64(l.template), l.template != 0
+	}
+	return lookupField(l.data, name)
+}
+
+// lookupField returns the value at path in data. A key containing dots is
+// tried as a whole before descending into nested objects.
+func lookupField(data map[string]any, path string) (any, bool) {
+	if v, ok := data[path]; ok {
+		return v, true
+	}
+	for i := strings.IndexByte(path, '.'); i >= 0; i = nextDot(path, i) {
+		child, ok := data[path[:i]].(map[string]any)
+		if !ok {
+			continue
+		}
+		if v, ok := lookupField(child, path[i+1:]); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func nextDot(path string, i int) int {
+	j := strings.IndexByte(path[i+1:], '.')
+	if j < 0 {
+		return -1
+	}
+	return i + 1 + j
+}
+
+// fieldNumber returns v as a number, if it is a number or a numeric string.
+func fieldNumber(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// fieldString formats a field value for display and string comparisons.
+func fieldString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
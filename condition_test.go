@@ -0,0 +1,140 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConditionErrors(t *testing.T) {
+	for _, in := range []string{"", "a=1 && ", "=1", "msg~(", "a>"} {
+		t.Run(in, func(t *testing.T) {
+			_, err := parseCondition(in)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSplitCondition(t *testing.T) {
+	assert.Equal(t, [][]string{{"a=1 ", " b=2 "}, {" c"}}, splitCondition("a=1 && b=2 || c"))
+	assert.Equal(t, [][]string{{"msg ~ a||b&&c"}}, splitCondition("msg ~ a||b&&c"))
+	assert.Equal(t, [][]string{{"msg~a "}, {" b"}}, splitCondition("msg~a || b"))
+	assert.Equal(t, [][]string{{`msg="a || b" `, " x"}}, splitCondition(`msg="a || b" && x`))
+	assert.Equal(t, [][]string{{`msg~\|`}, {"x"}}, splitCondition(`msg~\|||x`))
+	assert.Equal(t, [][]string{{"a=it's "}, {" b"}}, splitCondition("a=it's || b"))
+}
+
+func TestNewEqualCondition(t *testing.T) {
+	l := log{data: map[string]any{
+		"trace_id": "a && b || c=d",
+		"span":     float64(1e6),
+		"count":    "1000000",
+	}}
+
+	c := newEqualCondition("trace_id", "a && b || c=d")
+	assert.Equal(t, `trace_id = "a && b || c=d"`, c.source)
+	assert.True(t, c.match(&l))
+	assert.False(t, newEqualCondition("trace_id", "a").match(&l))
+
+	assert.True(t, newEqualCondition("span", float64(1e6)).match(&l))
+	assert.True(t, newEqualCondition("count", float64(1e6)).match(&l))
+	assert.False(t, newEqualCondition("span", float64(1)).match(&l))
+}
+
+func TestConditionWithFieldTypes(t *testing.T) {
+	isNumeric := func(field string) bool { return field == "status" }
+	l := log{data: map[string]any{"status": "n/a"}}
+	c, err := parseCondition("status>=500")
+	if !assert.NoError(t, err) {
+		return
+	}
+	// compared as strings, "n/a" >= "500"
+	assert.True(t, c.match(&l))
+	assert.False(t, c.withFieldTypes(isNumeric).match(&l))
+
+	l.data["status"] = "503"
+	assert.True(t, c.withFieldTypes(isNumeric).match(&l))
+
+	l.data["status"] = "n/a"
+	c, _ = parseCondition("status!=500")
+	assert.True(t, c.withFieldTypes(isNumeric).match(&l))
+	c, _ = parseCondition("name>=500")
+	l.data["name"] = "zed"
+	assert.True(t, c.withFieldTypes(isNumeric).match(&l))
+}
+
+func TestConditionTemplate(t *testing.T) {
+	l := log{template: 3, data: map[string]any{"template": "welcome-email"}}
+
+	c, err := parseCondition("@template == 3")
+	if assert.NoError(t, err) {
+		assert.True(t, c.match(&l))
+	}
+	c, err = parseCondition("template = welcome-email")
+	if assert.NoError(t, err) {
+		assert.True(t, c.match(&l))
+	}
+	assert.True(t, newEqualCondition(templateField, float64(3)).match(&l))
+	assert.False(t, newEqualCondition(templateField, float64(4)).match(&l))
+}
+
+func TestConditionMatch(t *testing.T) {
+	l := log{
+		level:    "warn",
+		severity: severityWarn,
+		message:  "request failed: timeout",
+		data: map[string]any{
+			"status":   float64(503),
+			"path":     "/api/users",
+			"user":     map[string]any{"id": float64(42), "name": "ada"},
+			"log.file": "server.go",
+			"retry":    true,
+			"code":     "0042",
+		},
+	}
+
+	type testCase struct {
+		in     string
+		expect bool
+	}
+	testCases := []testCase{
+		{in: "status>=500", expect: true},
+		{in: "status<500", expect: false},
+		{in: "status=503", expect: true},
+		{in: "status == 503", expect: true},
+		{in: "user.id=42", expect: true},
+		{in: "user.id!=42", expect: false},
+		{in: "user.name=ada", expect: true},
+		{in: `user.name="ada"`, expect: true},
+		{in: "log.file=server.go", expect: true},
+		{in: "code=42", expect: true},
+		{in: "code='0042'", expect: true},
+		{in: "level=warn", expect: true},
+		{in: "level>=warn", expect: true},
+		{in: "level>=error", expect: false},
+		{in: "level=WARNING", expect: true},
+		{in: "msg~timeout", expect: true},
+		{in: "message~^request", expect: true},
+		{in: "msg!~timeout", expect: false},
+		{in: "path~^/api/ && status>=500", expect: true},
+		{in: "path~^/web/ && status>=500", expect: false},
+		{in: "path~^/web/ || status>=500", expect: true},
+		{in: "msg~timeout||refused", expect: true},
+		{in: "msg~refused|timeout && status>=500", expect: true},
+		{in: "msg~refused||timeout || status<500", expect: true},
+		{in: `msg="a && b" || status=503`, expect: true},
+		{in: `msg='x || y'`, expect: false},
+		{in: "retry", expect: true},
+		{in: "missing", expect: false},
+		{in: "missing!=1", expect: true},
+		{in: "missing=1", expect: false},
+		{in: "missing!~x", expect: true},
+	}
+	for _, c := range testCases {
+		t.Run(c.in, func(t *testing.T) {
+			cond, err := parseCondition(c.in)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expect, cond.match(&l))
+		})
+	}
+}
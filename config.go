@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// config is the content of the JSON configuration file.
+type config struct {
+	// Keys maps action names to the keys that trigger them, replacing the
+	// default bindings of these actions.
+	Keys map[string][]string `json:"keys"`
+	// Theme is one of dark, light, high-contrast or monochrome.
+	Theme string `json:"theme"`
+	// Rules highlight the rows of matching logs. The first matching rule
+	// applies.
+	Rules []highlightRuleConfig `json:"rules"`
+	// Alerts notify of matching logs, or of too many matching logs.
+	Alerts []alertRuleConfig `json:"alerts"`
+	// Fields are computed from other fields when logs are appended, in
+	// order.
+	Fields []derivedFieldConfig `json:"fields"`
+}
+
+// defaultConfigPath returns the path of the configuration file in the user
+// configuration directory, e.g. ~/.config/ltop/config.json.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ltop", "config.json")
+}
+
+// loadConfig reads the configuration file at path. A missing file is only an
+// error if mustExist is true.
+func loadConfig(path string, mustExist bool) (config, error) {
+	var cfg config
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !mustExist {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("couldn't read config file: %w", err)
+	}
+
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "config.json")
+	err := os.WriteFile(path, []byte(`{"keys": {"quit": ["x"]}}`), 0644)
+	assert.NoError(t, err)
+
+	cfg, err := loadConfig(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"quit": {"x"}}, cfg.Keys)
+
+	missing := filepath.Join(dir, "missing.json")
+	_, err = loadConfig(missing, false)
+	assert.NoError(t, err)
+	_, err = loadConfig(missing, true)
+	assert.Error(t, err)
+
+	invalid := filepath.Join(dir, "invalid.json")
+	err = os.WriteFile(invalid, []byte(`{"keys":`), 0644)
+	assert.NoError(t, err)
+	_, err = loadConfig(invalid, false)
+	assert.Error(t, err)
+}
@@ -4,37 +4,72 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"golang.org/x/exp/slices"
 	"golang.org/x/exp/slog"
 )
 
 type DB struct {
-	sqlDB      *sql.DB
-	appendStmt *sql.Stmt
+	sqlDB        *sql.DB
+	appendStmt   *sql.Stmt
+	templateStmt *sql.Stmt
+	// timeFormat is an optional user-supplied layout tried before the
+	// built-in ones when parsing timestamp strings.
+	timeFormat string
+	timeErrors atomic.Int64
+	// replay paces the ingestion of logs by their timestamps, when set.
+	replay *replayer
+	// alerts checks appended logs against alert rules, when set.
+	alerts *alerter
+	// derived are the fields computed when logs are appended.
+	derived []derivedField
+	// templateMu keeps the templates table in the order of drain updates.
+	templateMu sync.Mutex
+	drain      *drain
+	// fields holds the statistics of the fields of appended logs.
+	fields *fieldCollector
+	// rates counts appended logs per second.
+	rates *rateTracker
 }
 
 type log struct {
 	id        int64
 	level     string
+	severity  severity
 	timestamp time.Time
 	message   string
-	data      map[string]any
+	// template is the ID of the message template, or 0.
+	template int64
+	// marked is true for bookmarked logs, which may have a note.
+	marked bool
+	note   string
+	data   map[string]any
 }
 
 const sqliteTimeLayout = "2006-01-02 15:04:05.999999999-07:00"
 
 func newDatabase(sqlDB *sql.DB) (*DB, error) {
-	db := DB{sqlDB: sqlDB}
+	db := DB{sqlDB: sqlDB, drain: newDrain(), fields: newFieldCollector(), rates: newRateTracker()}
+
+	// each connection to an in-memory database opens a new, empty database
+	sqlDB.SetMaxOpenConns(1)
 
 	slog.Info("creating table and indexes")
 	_, err := sqlDB.Exec(
-		"CREATE TABLE logs(timestamp DATETIME NOT NULL, level TEXT, data TEXT);" +
+		"CREATE TABLE logs(timestamp DATETIME NOT NULL, level TEXT, severity INTEGER NOT NULL DEFAULT 0, template_id INTEGER, data TEXT);" +
 			"CREATE INDEX logs__timestamp ON logs(timestamp);" +
-			"CREATE INDEX logs__level ON logs(level)",
+			"CREATE INDEX logs__level ON logs(level);" +
+			"CREATE INDEX logs__severity ON logs(severity);" +
+			"CREATE INDEX logs__template_id ON logs(template_id);" +
+			"CREATE TABLE templates(id INTEGER PRIMARY KEY, template TEXT NOT NULL);" +
+			"CREATE TABLE bookmarks(log_id INTEGER PRIMARY KEY, note TEXT NOT NULL DEFAULT '', created DATETIME NOT NULL)",
 	)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't create schema: %w", err)
@@ -42,11 +77,19 @@ func newDatabase(sqlDB *sql.DB) (*DB, error) {
 
 	slog.Info("preparing insert statement")
 	db.appendStmt, err = sqlDB.Prepare(
-		"INSERT INTO logs(timestamp, level, data) VALUES (:timestamp, :level, json(:data))",
+		"INSERT INTO logs(timestamp, level, severity, template_id, data)" +
+			" VALUES (:timestamp, :level, :severity, :template_id, json(:data))",
 	)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't prepare append statement: %w", err)
 	}
+	db.templateStmt, err = sqlDB.Prepare(
+		"INSERT INTO templates(id, template) VALUES (:id, :template)" +
+			" ON CONFLICT(id) DO UPDATE SET template = excluded.template",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't prepare template statement: %w", err)
+	}
 
 	return &db, nil
 }
@@ -54,6 +97,12 @@ func newDatabase(sqlDB *sql.DB) (*DB, error) {
 var invalidCharacters = regexp.MustCompile(`[^\w\d]+`)
 
 func (db *DB) appendLog(logJSON []byte) error {
+	return db.appendLogWithFields(logJSON, nil)
+}
+
+// appendLogWithFields appends a log with additional fields, such as its
+// source. Fields already present in the log are not replaced.
+func (db *DB) appendLogWithFields(logJSON []byte, fields map[string]any) error {
 	var logData map[string]any
 
 	slog.Info("unmarshaling JSON log")
@@ -61,58 +110,52 @@ func (db *DB) appendLog(logJSON []byte) error {
 	if err != nil {
 		return fmt.Errorf("invalid json data: %w", err)
 	}
+	if logData == nil {
+		return fmt.Errorf("invalid json data: not an object")
+	}
 
-	slog.Info("reading timestamp data")
-	timestampData, ok := logData["timestamp"]
-	if !ok {
-		timestampData, ok = logData["time"]
+	changed := false
+	for k, v := range fields {
+		if _, ok := logData[k]; !ok {
+			logData[k] = v
+			changed = true
+		}
 	}
-	if !ok {
-		timestampData, ok = logData["date"]
+	if addDerivedFields(logData, db.derived) {
+		changed = true
+	}
+	if changed {
+		logJSON, err = json.Marshal(logData)
+		if err != nil {
+			return fmt.Errorf("couldn't convert log: %w", err)
+		}
 	}
 
+	slog.Info("reading timestamp data")
 	var timestamp time.Time
-	if ok {
-		timestamp, _ = parseTime(timestampData)
+	if timestampData, ok := findTimestamp(logData); ok {
+		timestamp, err = parseTime(timestampData, db.timeFormat)
+		if err != nil {
+			slog.Warn("couldn't parse timestamp", "error", err)
+			db.timeErrors.Add(1)
+		}
 	}
 
 	if timestamp.IsZero() {
 		timestamp = time.Now()
+	} else if db.replay != nil {
+		db.replay.wait(timestamp)
 	}
 
 	slog.Info("reading level data")
-	levelData, ok := logData["level"].(string)
-	if !ok {
-		levelData, ok = logData["lvl"].(string)
-	}
-	var level string
-	if ok {
-		switch strings.ToLower(levelData) {
-		case "error", "erro", "err":
-			level = "error"
-		case "warning", "warn":
-			level = "warn"
-		case "info":
-			level = "info"
-		case "debug", "debu":
-			level = "debug"
-		default:
-			level = levelData
-		}
-	}
+	level, sev := findLevel(logData)
 
 	slog.Info("collecting prop names")
 	propNames := collectPropNames(logData)
 	if len(propNames) > 0 {
 		queryBuilder := strings.Builder{}
 		for _, name := range propNames {
-			queryBuilder.WriteString(
-				`CREATE INDEX IF NOT EXISTS "logs__` +
-					invalidCharacters.ReplaceAllString(name, "_") +
-					`" ON logs(json_extract(data, '$.` +
-					name +
-					"'));\n",
-			)
+			queryBuilder.WriteString(propIndexSQL(name))
 		}
 		if queryBuilder.Len() > 0 {
 			slog.Info("creating prop indexes", "prop_names", propNames)
@@ -123,27 +166,114 @@ func (db *DB) appendLog(logJSON []byte) error {
 		}
 	}
 
-	slog.Info("inserting log in database", "timestamp", timestamp, "level", level)
-	_, err = db.appendStmt.Exec(
+	slog.Info("inserting log in database", "timestamp", timestamp, "level", level, "severity", sev)
+	templateID, err := db.clusterMessage(logData)
+	if err != nil {
+		return err
+	}
+
+	result, err := db.appendStmt.Exec(
 		sql.Named("timestamp", timestamp.UTC()),
 		sql.Named("level", level),
+		sql.Named("severity", sev),
+		sql.Named("template_id", templateID),
 		sql.Named("data", logJSON),
 	)
 	if err != nil {
 		return fmt.Errorf("couldn't add log to database: %w", err)
 	}
+	db.fields.observe(logData)
+	db.rates.add(timestamp, sev >= severityError)
+
+	if db.alerts != nil {
+		id, _ := result.LastInsertId()
+		message, _ := logMessage(logData)
+		db.alerts.check(log{
+			id:        id,
+			level:     level,
+			severity:  sev,
+			timestamp: timestamp,
+			message:   message,
+			template:  templateID.Int64,
+			data:      logData,
+		})
+	}
 
 	return nil
 }
 
+// clusterMessage adds the message of a log to its template, and stores the
+// template when it changes. It returns the template ID, or NULL for logs
+// without a message.
+func (db *DB) clusterMessage(logData map[string]any) (sql.NullInt64, error) {
+	message, ok := logMessage(logData)
+	if !ok {
+		return sql.NullInt64{}, nil
+	}
+
+	db.templateMu.Lock()
+	defer db.templateMu.Unlock()
+	id, template, changed := db.drain.add(message)
+	if id == 0 {
+		return sql.NullInt64{}, nil
+	}
+	if changed {
+		_, err := db.templateStmt.Exec(sql.Named("id", id), sql.Named("template", template))
+		if err != nil {
+			return sql.NullInt64{}, fmt.Errorf("couldn't store template: %w", err)
+		}
+	}
+	return sql.NullInt64{Int64: id, Valid: true}, nil
+}
+
+// logMessage returns the message of a log, from the field of its schema, or
+// the message or msg field.
+func logMessage(logData map[string]any) (string, bool) {
+	if msg := findSchemaFields(logData).message; msg != nil {
+		return fmt.Sprint(msg), true
+	}
+	return messageField(logData)
+}
+
+// messageField returns the message or msg field of a log.
+func messageField(logData map[string]any) (string, bool) {
+	if msg, ok := logData["message"]; ok {
+		return fmt.Sprint(msg), true
+	}
+	if msg, ok := logData["msg"]; ok {
+		return fmt.Sprint(msg), true
+	}
+	return "", false
+}
+
 func (db *DB) queryLogs(from, to time.Time) ([]log, error) {
-	slog.Info("querying logs", "from", from, "to", to)
-	rows, err := db.sqlDB.Query("SELECT rowid, timestamp, level, data"+
-		" FROM logs"+
-		" WHERE timestamp BETWEEN ? AND ?"+
-		" ORDER BY timestamp DESC",
-		from,
-		to,
+	return db.queryLogsSorted(from, to, "")
+}
+
+// queryLogsSorted returns the logs between from and to sorted by a field,
+// then newest first. Fields holding numbers, even written as strings, are
+// sorted as numbers, largest first, and other fields in ascending order. Logs
+// without the field come last. An empty field sorts by timestamp only.
+func (db *DB) queryLogsSorted(from, to time.Time, field string) ([]log, error) {
+	slog.Info("querying logs", "from", from, "to", to, "sort", field)
+	order := "logs.timestamp DESC"
+	args := []any{sql.Named("from", from), sql.Named("to", to)}
+	if field != "" {
+		paths := jsonPaths(field)
+		value := "json_extract(logs.data, " + fieldPathSQL("logs.data", len(paths)) + ")"
+		if db.fields.isNumeric(field) {
+			order = "CAST(" + value + " AS REAL) DESC NULLS LAST, " + order
+		} else {
+			order = value + " ASC NULLS LAST, " + order
+		}
+		args = append(args, fieldPathArgs(paths)...)
+	}
+
+	rows, err := db.sqlDB.Query("SELECT "+logColumns+
+		" FROM logs LEFT JOIN bookmarks ON bookmarks.log_id = logs.rowid"+
+		" WHERE logs.timestamp BETWEEN :from AND :to"+
+		" ORDER BY "+order,
+		args...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query logs: %w", err)
@@ -152,79 +282,399 @@ func (db *DB) queryLogs(from, to time.Time) ([]log, error) {
 
 	logs := []log{}
 	for rows.Next() {
-		var id int64
-		var ts time.Time
-		var level string
-		var logJSON []byte
-
-		err := rows.Scan(&id, &ts, &level, &logJSON)
+		l, err := scanLog(rows)
 		if err != nil {
 			slog.Error("error scanning row: %s", err)
 			continue
 		}
+		logs = append(logs, l)
+	}
 
-		var message string
-		var logData map[string]any
+	return logs, nil
+}
 
-		err = json.Unmarshal(logJSON, &logData)
-		if err != nil {
-			message = string(logJSON)
-		} else if msg, ok := logData["message"]; ok {
-			message = fmt.Sprint(msg)
-		} else if msg, ok := logData["msg"]; ok {
-			message = fmt.Sprint(msg)
+// jsonPathKey matches the object keys written as is in JSON paths.
+var jsonPathKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// maxPathDots is the number of dots in a field name above which jsonPaths
+// only tries the name as a single key and as fully nested keys, rather than
+// every split.
+const maxPathDots = 4
+
+// jsonPaths returns the SQLite JSON paths a field can be found at, in the
+// order lookupField tries them: the name as a single key first, as written by
+// ECS and OpenTelemetry, then split at each dot into nested objects, e.g.
+// $."log.level" then $.log.level.
+func jsonPaths(field string) []string {
+	keys := [][]string{{field}, strings.Split(field, ".")}
+	if strings.Count(field, ".") <= maxPathDots {
+		keys = splitKeys(field)
+	}
+	paths := make([]string, 0, len(keys))
+	for _, k := range keys {
+		paths = append(paths, jsonPath(k))
+	}
+	return paths
+}
+
+// splitKeys returns every way of splitting a field name at dots into nested
+// keys, in the order of lookupField.
+func splitKeys(field string) [][]string {
+	keys := [][]string{{field}}
+	for i := strings.IndexByte(field, '.'); i >= 0; i = nextDot(field, i) {
+		for _, rest := range splitKeys(field[i+1:]) {
+			keys = append(keys, append([]string{field[:i]}, rest...))
+		}
+	}
+	return keys
+}
+
+// jsonPath returns the SQLite JSON path of nested keys, e.g.
+// $.http."status-code".
+func jsonPath(keys []string) string {
+	builder := strings.Builder{}
+	builder.WriteString("$")
+	for _, key := range keys {
+		if jsonPathKey.MatchString(key) {
+			builder.WriteString("." + key)
 		} else {
-			message = string(logJSON)
+			builder.WriteString(`."` + strings.ReplaceAll(key, `"`, `\"`) + `"`)
 		}
+	}
+	return builder.String()
+}
 
-		logs = append(logs, log{
-			id:        id,
-			timestamp: ts,
-			level:     level,
-			message:   message,
-			data:      logData,
-		})
+// fieldPathSQL returns an SQL expression evaluating to the first of n JSON
+// paths, in the parameters added by fieldPathArgs, that exists in column.
+func fieldPathSQL(column string, n int) string {
+	if n == 1 {
+		return ":path0"
+	}
+	builder := strings.Builder{}
+	builder.WriteString("CASE")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&builder, " WHEN json_type(%s, :path%d) IS NOT NULL THEN :path%d", column, i, i)
+	}
+	builder.WriteString(" END")
+	return builder.String()
+}
+
+// fieldPathArgs returns the parameters of fieldPathSQL.
+func fieldPathArgs(paths []string) []any {
+	args := make([]any, 0, len(paths))
+	for i, p := range paths {
+		args = append(args, sql.Named(fmt.Sprintf("path%d", i), p))
+	}
+	return args
+}
+
+// queryContext returns the log with the given row id with up to before older
+// and after newer logs, newest first. Logs with the same timestamp are ordered
+// by row id.
+func (db *DB) queryContext(id int64, before, after int) ([]log, error) {
+	slog.Info("querying context", "id", id, "before", before, "after", after)
+	newer, err := db.queryContextSide(id, ">=", "ASC", after+1)
+	if err != nil {
+		return nil, err
+	}
+	older, err := db.queryContextSide(id, "<", "DESC", before)
+	if err != nil {
+		return nil, err
 	}
 
+	logs := make([]log, 0, len(newer)+len(older))
+	for i := len(newer) - 1; i >= 0; i-- {
+		logs = append(logs, newer[i])
+	}
+	return append(logs, older...), nil
+}
+
+// queryContextSide returns up to limit logs on one side of the log with the
+// given row id, in the order of op and dir.
+func (db *DB) queryContextSide(id int64, op, dir string, limit int) ([]log, error) {
+	rows, err := db.sqlDB.Query("SELECT "+logColumns+
+		" FROM logs LEFT JOIN bookmarks ON bookmarks.log_id = logs.rowid"+
+		" WHERE (logs.timestamp, logs.rowid) "+op+" (SELECT timestamp, rowid FROM logs WHERE rowid = ?)"+
+		" ORDER BY logs.timestamp "+dir+", logs.rowid "+dir+
+		" LIMIT ?",
+		id,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query context: %w", err)
+	}
+	defer rows.Close()
+
+	logs := []log{}
+	for rows.Next() {
+		l, err := scanLog(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan context: %w", err)
+		}
+		logs = append(logs, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query context: %w", err)
+	}
 	return logs, nil
 }
 
-func parseTime(t any) (time.Time, error) {
+// logColumns are the columns read by scanLog.
+const logColumns = "logs.rowid, logs.timestamp, logs.level, logs.severity, logs.template_id, logs.data, bookmarks.note"
+
+// scanLog reads a log from the logColumns of rows, followed by the columns
+// scanned into extra.
+func scanLog(rows *sql.Rows, extra ...any) (log, error) {
+	var id int64
+	var ts time.Time
+	var level string
+	var sev severity
+	var template sql.NullInt64
+	var logJSON []byte
+	var note sql.NullString
+
+	dest := append([]any{&id, &ts, &level, &sev, &template, &logJSON, &note}, extra...)
+	err := rows.Scan(dest...)
+	if err != nil {
+		return log{}, err
+	}
+
+	var message string
+	var logData map[string]any
+
+	err = json.Unmarshal(logJSON, &logData)
+	if err != nil {
+		message = string(logJSON)
+	} else if msg, ok := logMessage(logData); ok {
+		message = msg
+	} else {
+		message = string(logJSON)
+	}
+
+	return log{
+		id:        id,
+		timestamp: ts,
+		level:     level,
+		severity:  sev,
+		message:   message,
+		template:  template.Int64,
+		marked:    note.Valid,
+		note:      note.String,
+		data:      logData,
+	}, nil
+}
+
+// templateStats summarizes the logs of a message template.
+type templateStats struct {
+	id       int64
+	template string
+	count    int
+	first    time.Time
+	last     time.Time
+	// levels counts the logs of each level.
+	levels map[string]int
+}
+
+// queryTemplates returns the templates of the logs between from and to, most
+// frequent first.
+func (db *DB) queryTemplates(from, to time.Time) ([]templateStats, error) {
+	slog.Info("querying templates", "from", from, "to", to)
+	rows, err := db.sqlDB.Query("SELECT logs.template_id, templates.template, logs.level,"+
+		" COUNT(*), MIN(logs.timestamp), MAX(logs.timestamp)"+
+		" FROM logs JOIN templates ON templates.id = logs.template_id"+
+		" WHERE logs.timestamp BETWEEN ? AND ?"+
+		" GROUP BY logs.template_id, logs.level",
+		from,
+		to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query templates: %w", err)
+	}
+	defer rows.Close()
+
+	byID := map[int64]*templateStats{}
+	for rows.Next() {
+		var id int64
+		var template, level string
+		var count int
+		var first, last any
+		err := rows.Scan(&id, &template, &level, &count, &first, &last)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan template: %w", err)
+		}
+
+		ts, ok := byID[id]
+		if !ok {
+			ts = &templateStats{id: id, template: template, levels: map[string]int{}}
+			byID[id] = ts
+		}
+		ts.count += count
+		ts.levels[level] += count
+		if t, err := sqliteTime(first); err == nil && (ts.first.IsZero() || t.Before(ts.first)) {
+			ts.first = t
+		}
+		if t, err := sqliteTime(last); err == nil && t.After(ts.last) {
+			ts.last = t
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query templates: %w", err)
+	}
+
+	stats := make([]templateStats, 0, len(byID))
+	for _, ts := range byID {
+		stats = append(stats, *ts)
+	}
+	slices.SortFunc(stats, func(a, b templateStats) bool {
+		if a.count != b.count {
+			return a.count > b.count
+		}
+		return a.id < b.id
+	})
+	return stats, nil
+}
+
+// sqliteTime converts a timestamp returned by an aggregate function, which
+// the driver doesn't convert to time.Time.
+func sqliteTime(v any) (time.Time, error) {
+	var s string
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC(), nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return time.Time{}, fmt.Errorf("invalid timestamp: %v", v)
+	}
+	t, err := time.Parse(sqliteTimeLayout, s)
+	return t.UTC(), err
+}
+
+// timestampKeys are the JSON keys looked up, in order, for the log timestamp.
+var timestampKeys = []string{"timestamp", "time", "date", "ts"}
+
+// timeLayouts are tried in order when parsing timestamp strings, after
+// RFC3339 and numeric epochs.
+var timeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC850,
+	time.RFC822Z,
+	time.RFC822,
+	time.RubyDate,
+	time.UnixDate,
+	time.ANSIC,
+	time.Layout,
+	time.DateTime,
+	time.DateOnly,
+	time.StampNano,
+	time.StampMicro,
+	time.StampMilli,
+	time.Stamp,
+	time.Kitchen,
+	time.TimeOnly,
+}
+
+// timeLayoutNames maps names of the time package constants to their layout.
+var timeLayoutNames = map[string]string{
+	"Layout":      time.Layout,
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+// findTimestamp returns the timestamp field of the schema of logData, or the
+// value of the first timestamp key present in it.
+func findTimestamp(logData map[string]any) (any, bool) {
+	if t := findSchemaFields(logData).timestamp; t != nil {
+		return t, true
+	}
+	for _, key := range timestampKeys {
+		if t, ok := logData[key]; ok && t != nil {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// timeErrorCount returns the number of logs whose timestamp couldn't be
+// parsed and were stamped with their ingestion time instead.
+func (db *DB) timeErrorCount() int64 {
+	return db.timeErrors.Load()
+}
+
+// parseTime parses a timestamp decoded from JSON. Numbers, and numeric
+// strings, are read as Unix epochs whose unit is guessed from their
+// magnitude. Strings are parsed with the given layouts first, then
+// RFC3339 and timeLayouts.
+func parseTime(t any, layouts ...string) (time.Time, error) {
 	switch t := t.(type) {
 	case int:
-		return time.UnixMilli(int64(t)), nil
+		return epochTime(int64(t)), nil
 	case int8:
-		return time.UnixMilli(int64(t)), nil
+		return epochTime(int64(t)), nil
 	case int16:
-		return time.UnixMilli(int64(t)), nil
+		return epochTime(int64(t)), nil
 	case int32:
-		return time.UnixMilli(int64(t)), nil
+		return epochTime(int64(t)), nil
 	case int64:
-		return time.UnixMilli(t), nil
+		return epochTime(t), nil
 	case uint:
-		return time.UnixMilli(int64(t)), nil
+		return epochTime(int64(t)), nil
 	case uint8:
-		return time.UnixMilli(int64(t)), nil
+		return epochTime(int64(t)), nil
 	case uint16:
-		return time.UnixMilli(int64(t)), nil
+		return epochTime(int64(t)), nil
 	case uint32:
-		return time.UnixMilli(int64(t)), nil
+		return epochTime(int64(t)), nil
 	case float32:
-		return time.UnixMilli(int64(t)), nil
+		return epochTimeFloat(float64(t)), nil
 	case float64:
-		return time.UnixMilli(int64(t)), nil
+		return epochTimeFloat(t), nil
 	case string:
+		for _, layout := range layouts {
+			if layout == "" {
+				continue
+			}
+			ts, err := time.Parse(layout, t)
+			if err == nil {
+				return completeDate(ts, layout), nil
+			}
+		}
 		ts, err := time.Parse(time.RFC3339Nano, t)
 		if err == nil {
 			return ts, nil
 		}
-		tsInt, err := strconv.Atoi(t)
+		tsInt, err := strconv.ParseInt(t, 10, 64)
 		if err == nil {
-			return time.UnixMilli(int64(tsInt)), nil
+			return epochTime(tsInt), nil
 		}
-		ts, err = time.Parse(time.Stamp, t)
-		if err == nil {
-			return ts.AddDate(time.Now().Year(), 0, 0), nil
+		tsFloat, err := strconv.ParseFloat(t, 64)
+		if err == nil && !math.IsInf(tsFloat, 0) && !math.IsNaN(tsFloat) {
+			return epochTimeFloat(tsFloat), nil
+		}
+		for _, layout := range timeLayouts {
+			ts, err = time.Parse(layout, t)
+			if err == nil {
+				return completeDate(ts, layout), nil
+			}
 		}
 		return time.Time{}, fmt.Errorf("failed to parse timestamp: \"%s\"", t)
 	default:
@@ -232,6 +682,69 @@ func parseTime(t any) (time.Time, error) {
 	}
 }
 
+// epochTime converts an integer Unix epoch to a time. Values are read as
+// seconds, milliseconds, microseconds or nanoseconds depending on their
+// magnitude, which works for dates between 1973 and 5138.
+func epochTime(n int64) time.Time {
+	abs := n
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case abs < 1e11:
+		return time.Unix(n, 0)
+	case abs < 1e14:
+		return time.UnixMilli(n)
+	case abs < 1e17:
+		return time.UnixMicro(n)
+	default:
+		return time.Unix(0, n)
+	}
+}
+
+// epochTimeFloat is like epochTime, but keeps fractional seconds,
+// rounded to the microsecond to absorb floating-point noise.
+func epochTimeFloat(f float64) time.Time {
+	abs := math.Abs(f)
+	switch {
+	case abs < 1e11:
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e6))*1e3)
+	case abs < 1e14:
+		return time.Unix(0, int64(math.Round(f*1e3))*1e3)
+	case abs < 1e17:
+		return time.Unix(0, int64(math.Round(f))*1e3)
+	default:
+		return time.Unix(0, int64(f))
+	}
+}
+
+// completeDate fills in the date for layouts that don't include one, with the
+// current year for syslog-style stamps and the current day for times of day.
+func completeDate(ts time.Time, layout string) time.Time {
+	if ts.Year() != 0 {
+		return ts
+	}
+	now := time.Now().In(ts.Location())
+	if ts.Month() == time.January && ts.Day() == 1 && !strings.Contains(layout, "Jan") {
+		return time.Date(
+			now.Year(), now.Month(), now.Day(),
+			ts.Hour(), ts.Minute(), ts.Second(), ts.Nanosecond(),
+			ts.Location(),
+		)
+	}
+	return ts.AddDate(now.Year(), 0, 0)
+}
+
+// propIndexSQL returns the statement creating the index of a field. Field
+// names come from the logs, so the index name and JSON path are quoted.
+func propIndexSQL(name string) string {
+	index := "logs__" + invalidCharacters.ReplaceAllString(name, "_")
+	path := jsonPath(strings.Split(name, "."))
+	return `CREATE INDEX IF NOT EXISTS "` + strings.ReplaceAll(index, `"`, `""`) +
+		`" ON logs(json_extract(data, '` + strings.ReplaceAll(path, "'", "''") + "'));\n"
+}
+
 func collectPropNames(m map[string]any) []string {
 	propNames := make([]string, 0, len(m))
 	for name, child := range m {
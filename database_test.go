@@ -79,9 +79,10 @@ func TestCollectPropNames(t *testing.T) {
 
 func TestParseTime(t *testing.T) {
 	type testCase struct {
-		in     any
-		expect time.Time
-		err    bool
+		in      any
+		layouts []string
+		expect  time.Time
+		err     bool
 	}
 	testCases := []testCase{
 		{in: millis, expect: timestamp},
@@ -90,10 +91,33 @@ func TestParseTime(t *testing.T) {
 		{in: rfc3339TZ, expect: timestamp},
 		{in: strconv.Itoa(int(millis)), expect: timestamp},
 		{in: syslog, expect: timestamp.Truncate(time.Second)},
+		{in: timestamp.Unix(), expect: timestamp.Truncate(time.Second)},
+		{in: timestamp.UnixMicro(), expect: timestamp},
+		{in: timestamp.UnixNano(), expect: timestamp},
+		{in: float64(millis), expect: timestamp},
+		{in: float64(millis) / 1000, expect: timestamp},
+		{in: float64(1690000000.123), expect: time.Unix(1690000000, 123000000).UTC()},
+		{in: "1690000000.123", expect: time.Unix(1690000000, 123000000).UTC()},
+		{in: strconv.FormatInt(timestamp.UnixNano(), 10), expect: timestamp},
+		{in: timestamp.Format(time.RFC1123Z), expect: timestamp.Truncate(time.Second)},
+		{in: timestamp.Format(time.UnixDate), expect: timestamp.Truncate(time.Second)},
+		{in: timestamp.Format(time.DateTime), expect: timestamp.Truncate(time.Second)},
+		{in: timestamp.Format(time.StampMilli), expect: timestamp},
+		{in: timestamp.Format(time.DateOnly), expect: timestamp.Truncate(24 * time.Hour)},
+		{
+			in:     timestamp.Format(time.TimeOnly),
+			expect: timestamp.Truncate(time.Second),
+		},
+		{
+			in:      timestamp.Format("02/01/2006 15h04m05s"),
+			layouts: []string{"02/01/2006 15h04m05s"},
+			expect:  timestamp.Truncate(time.Second),
+		},
+		{in: "yesterday", err: true},
 	}
 	for _, c := range testCases {
 		t.Run(fmt.Sprintf("%T(%v)", c.in, c.in), func(t *testing.T) {
-			got, err := parseTime(c.in)
+			got, err := parseTime(c.in, c.layouts...)
 			if c.err {
 				assert.Error(t, err)
 				return
@@ -116,6 +140,9 @@ func TestNewDatabase(t *testing.T) {
 	if db.appendStmt == nil {
 		t.Fatalf("missing prepared statement for 'append'")
 	}
+	if db.templateStmt == nil {
+		t.Fatalf("missing prepared statement for 'template'")
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("expectations were not met: %s", err)
@@ -127,8 +154,12 @@ type appendLogTestCase struct {
 	input     string
 	timestamp time.Time
 	level     string
+	severity  severity
 	indexes   []string
-	err       bool
+	// templateID and template are expected for logs with a message.
+	templateID int64
+	template   string
+	err        bool
 }
 
 func TestAppendLog(t *testing.T) {
@@ -148,6 +179,17 @@ func TestAppendLog(t *testing.T) {
 			timestamp: timestamp,
 			indexes:   []string{"time"},
 		},
+		{
+			name:      "with ts in seconds",
+			input:     fmt.Sprintf(`{"ts":%d.%03d}`, millis/1000, millis%1000),
+			timestamp: timestamp,
+			indexes:   []string{"ts"},
+		},
+		{
+			name:    "with invalid timestamp",
+			input:   `{"timestamp":"yesterday"}`,
+			indexes: []string{"timestamp"},
+		},
 		{
 			name:      "with date",
 			input:     fmt.Sprintf(`{"date":%d}`, millis),
@@ -155,9 +197,30 @@ func TestAppendLog(t *testing.T) {
 			indexes:   []string{"date"},
 		},
 		{
-			name:    "with level",
-			input:   `{"level":"info"}`,
-			level:   "info",
+			name:     "with level",
+			input:    `{"level":"info"}`,
+			level:    "info",
+			severity: severityInfo,
+			indexes:  []string{"level"},
+		},
+		{
+			name:     "with numeric level",
+			input:    `{"level":50}`,
+			level:    "error",
+			severity: severityError,
+			indexes:  []string{"level"},
+		},
+		{
+			name:     "with zap level",
+			input:    `{"L":"DPANIC"}`,
+			level:    "panic",
+			severity: severityPanic,
+			indexes:  []string{"L"},
+		},
+		{
+			name:    "with unknown level",
+			input:   `{"level":"verbose"}`,
+			level:   "verbose",
 			indexes: []string{"level"},
 		},
 		{
@@ -169,6 +232,13 @@ func TestAppendLog(t *testing.T) {
 			timestamp: timestamp,
 			indexes:   []string{"timestamp", "hello", "one", "empty", "nested_toto"},
 		},
+		{
+			name:       "with message",
+			input:      `{"msg":"It's 20:34:11.244"}`,
+			indexes:    []string{"msg"},
+			templateID: 1,
+			template:   "It's <*>",
+		},
 	}
 
 	for _, c := range testCases {
@@ -186,6 +256,21 @@ func TestAppendLog(t *testing.T) {
 	}
 }
 
+func TestAppendLogQuotedKeys(t *testing.T) {
+	db := testOpenDatabase(t)
+	keys := []string{`it's`, `say "hi"`, `x')); DROP TABLE logs; --`, `a'.b"`}
+	for _, key := range keys {
+		logJSON, err := json.Marshal(map[string]any{key: "value", "msg": key})
+		assert.NoError(t, err)
+		assert.NoError(t, db.appendLog(logJSON))
+	}
+
+	logs := testWaitLogs(t, db, len(keys))
+	for _, l := range logs {
+		assert.Equal(t, "value", l.data[l.message])
+	}
+}
+
 func TestQueryLogs(t *testing.T) {
 	sqlDB, mock, err := sqlmock.New()
 	if err != nil {
@@ -198,16 +283,26 @@ func TestQueryLogs(t *testing.T) {
 	from := timestamp.Add(-15 * time.Minute)
 	to := timestamp
 	expect := []log{}
-	rows := sqlmock.NewRows([]string{"timestamp", "level", "data"})
+	rows := sqlmock.NewRows([]string{"rowid", "timestamp", "level", "severity", "template_id", "data", "note"})
+	id := int64(1)
 	for t := from; t.Before(to); t = t.Add(time.Minute) {
 		msg := fmt.Sprintf("It's %s", t)
 		logData := map[string]any{"timestamp": float64(t.UnixMilli()), "level": "info", "msg": msg}
 		logJSON, _ := json.Marshal(logData)
-		rows.AddRow(t, "info", logJSON)
-		expect = append(expect, log{timestamp: t, level: "info", message: msg, data: logData})
+		rows.AddRow(id, t, "info", int64(severityInfo), int64(1), logJSON, nil)
+		expect = append(expect, log{
+			id:        id,
+			timestamp: t,
+			level:     "info",
+			severity:  severityInfo,
+			message:   msg,
+			template:  1,
+			data:      logData,
+		})
+		id++
 	}
 
-	mock.ExpectQuery("SELECT timestamp, level, data FROM logs").
+	mock.ExpectQuery("SELECT logs.rowid, .*, bookmarks.note FROM logs LEFT JOIN bookmarks").
 		WithArgs(from, to).
 		WillReturnRows(rows)
 
@@ -218,9 +313,12 @@ func TestQueryLogs(t *testing.T) {
 
 func testCreateDatabase(t *testing.T, sqlDB *sql.DB, mock sqlmock.Sqlmock) *DB {
 	mock.
-		ExpectExec("CREATE TABLE logs.*CREATE INDEX logs__timestamp ON logs.*CREATE INDEX logs__level ON logs").
+		ExpectExec("CREATE TABLE logs.*CREATE INDEX logs__timestamp ON logs.*CREATE INDEX logs__level ON logs.*" +
+			"CREATE INDEX logs__severity ON logs.*CREATE INDEX logs__template_id ON logs.*CREATE TABLE templates.*" +
+			"CREATE TABLE bookmarks").
 		WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectPrepare("INSERT INTO logs")
+	mock.ExpectPrepare("INSERT INTO templates")
 
 	db, err := newDatabase(sqlDB)
 	if err != nil {
@@ -244,11 +342,20 @@ func testAppendLog(t *testing.T, c appendLogTestCase, db *DB, mock sqlmock.Sqlmo
 		}
 		mock.ExpectExec(createIndexString).WillReturnResult(sqlmock.NewResult(0, 0))
 	}
+	if c.template != "" {
+		mock.ExpectExec("INSERT INTO templates").
+			WithArgs(c.templateID, c.template).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	var templateID any
+	if c.templateID != 0 {
+		templateID = c.templateID
+	}
 	expectedExec := mock.ExpectExec("INSERT INTO logs")
 	if c.timestamp.IsZero() {
-		expectedExec = expectedExec.WithArgs(anyTime{}, c.level, []byte(c.input))
+		expectedExec = expectedExec.WithArgs(anyTime{}, c.level, c.severity, templateID, []byte(c.input))
 	} else {
-		expectedExec = expectedExec.WithArgs(c.timestamp, c.level, []byte(c.input))
+		expectedExec = expectedExec.WithArgs(c.timestamp, c.level, c.severity, templateID, []byte(c.input))
 	}
 	expectedExec.WillReturnResult(sqlmock.NewResult(1, 1))
 
@@ -268,3 +375,41 @@ func testAppendLog(t *testing.T, c appendLogTestCase, db *DB, mock sqlmock.Sqlmo
 		t.Fatalf("expectations were not met: %s", err)
 	}
 }
+
+func TestQueryContext(t *testing.T) {
+	db := testOpenDatabase(t)
+	start := time.Date(2023, time.July, 24, 18, 34, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		// logs 3 and 4 share a timestamp, and are ordered by row id
+		ts := start.Add(time.Duration(i) * time.Second)
+		if i == 3 {
+			ts = ts.Add(time.Second)
+		}
+		logJSON := fmt.Sprintf(`{"timestamp":"%s","msg":"log %d"}`, ts.Format(time.RFC3339), i)
+		assert.NoError(t, db.appendLog([]byte(logJSON)))
+	}
+
+	ids := func(logs []log) []int64 {
+		ids := []int64{}
+		for _, l := range logs {
+			ids = append(ids, l.id)
+		}
+		return ids
+	}
+
+	logs, err := db.queryContext(4, 2, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{5, 4, 3, 2}, ids(logs))
+
+	logs, err = db.queryContext(5, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{6, 5, 4}, ids(logs))
+
+	logs, err = db.queryContext(1, 3, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1}, ids(logs))
+
+	logs, err = db.queryContext(42, 3, 3)
+	assert.NoError(t, err)
+	assert.Empty(t, logs)
+}
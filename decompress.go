@@ -0,0 +1,139 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+	tarMagic   = []byte("ustar")
+)
+
+// tarMagicOffset is the offset of the magic string in a tar header.
+const tarMagicOffset = 257
+
+// scanArchive appends the logs read from r, which may be compressed with
+// gzip, zstd or bzip2, and may be a tar archive, a journal export stream or
+// OTLP/JSON logs. Compression is detected from magic bytes, and each member
+// of an archive is tagged with its name in the "source" field. source is the
+// name of the member being read, or empty.
+func scanArchive(r io.Reader, source string, db *DB) error {
+	return scanFormat(bufio.NewReader(r), source, db, false)
+}
+
+// scanStream is scanArchive for live input such as a pipe: the format is
+// detected from the bytes of the first read only, instead of waiting for a
+// whole tar header, so that the first lines are ingested as they arrive.
+func scanStream(r io.Reader, db *DB) error {
+	return scanFormat(bufio.NewReader(r), "", db, true)
+}
+
+// peekHeader returns up to the first n bytes of br, fewer at the end of the
+// input. When live, it only waits for the first read, and returns the bytes
+// buffered by it.
+func peekHeader(br *bufio.Reader, n int, live bool) []byte {
+	if live {
+		_, _ = br.Peek(1)
+		if br.Buffered() < n {
+			n = br.Buffered()
+		}
+	}
+	header, _ := br.Peek(n)
+	return header
+}
+
+// scanFormat appends the logs read from br, detecting their format as
+// described by scanArchive.
+func scanFormat(br *bufio.Reader, source string, db *DB, live bool) error {
+	magic := peekHeader(br, 4, live)
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		slog.Info("decompressing gzip input", "source", source)
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("invalid gzip input: %w", err)
+		}
+		defer gz.Close()
+		return scanArchive(gz, source, db)
+	case bytes.HasPrefix(magic, zstdMagic):
+		slog.Info("decompressing zstd input", "source", source)
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("invalid zstd input: %w", err)
+		}
+		defer zr.Close()
+		return scanArchive(zr, source, db)
+	case bytes.HasPrefix(magic, bzip2Magic):
+		slog.Info("decompressing bzip2 input", "source", source)
+		return scanArchive(bzip2.NewReader(br), source, db)
+	}
+
+	header := peekHeader(br, tarMagicOffset+len(tarMagic), live)
+	if bytes.HasSuffix(header, tarMagic) && len(header) == tarMagicOffset+len(tarMagic) {
+		return scanTar(br, db)
+	}
+	if isJournalExport(header) {
+		return scanJournalExport(br, source, db)
+	}
+	if isOTLPStream(header) {
+		return scanOTLP(br, source, db)
+	}
+
+	return scanLines(br, source, db)
+}
+
+// scanTar appends the logs of every regular file in a tar archive.
+func scanTar(r io.Reader, db *DB) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		slog.Info("reading archive member", "name", hdr.Name, "size", hdr.Size)
+		err = scanArchive(tr, hdr.Name, db)
+		if err != nil {
+			return fmt.Errorf("couldn't read %s: %w", hdr.Name, err)
+		}
+	}
+}
+
+// scanLines appends each line read from r, with source in the "source" field
+// if not empty.
+func scanLines(r io.Reader, source string, db *DB) error {
+	var fields map[string]any
+	if source != "" {
+		fields = map[string]any{"source": source}
+	}
+
+	decoder := newEnvelopeDecoder()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, bufio.MaxScanTokenSize*16)
+	for scanner.Scan() {
+		slog.Info("read line from input", "length", len(scanner.Bytes()))
+		err := decoder.appendLine(db, scanner.Bytes(), fields)
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
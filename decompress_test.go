@@ -0,0 +1,145 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+// bzip2Logs is `{"msg":"bzip2"}` compressed with bzip2, since the standard
+// library can only decompress.
+const bzip2Logs = "QlpoOTFBWSZTWQskHokAAAdZgAAQEAAQEBCiSBogACKaYTD1CAaACHIv/MPYA2i7kinChIBZIPRI"
+
+func testGzip(t *testing.T, data []byte) []byte {
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func testTar(t *testing.T, members map[string][]byte) []byte {
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := bytes.Buffer{}
+	tw := tar.NewWriter(&buf)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "logs/", Typeflag: tar.TypeDir, Mode: 0755}))
+	for _, name := range names {
+		err := tw.WriteHeader(&tar.Header{Name: name, Size: int64(len(members[name])), Mode: 0644})
+		assert.NoError(t, err)
+		_, err = tw.Write(members[name])
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestScanArchive(t *testing.T) {
+	zstdEncoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating zstd encoder: %s", err)
+	}
+	bzip2Data, _ := base64.StdEncoding.DecodeString(bzip2Logs)
+
+	type testCase struct {
+		name    string
+		in      []byte
+		expect  map[string]string
+		wantErr bool
+	}
+	testCases := []testCase{
+		{
+			name:   "plain",
+			in:     []byte(`{"msg":"plain"}`),
+			expect: map[string]string{"plain": ""},
+		},
+		{
+			name:   "gzip",
+			in:     testGzip(t, []byte("{\"msg\":\"gzip\"}\n")),
+			expect: map[string]string{"gzip": ""},
+		},
+		{
+			name:   "zstd",
+			in:     zstdEncoder.EncodeAll([]byte("{\"msg\":\"zstd\"}\n"), nil),
+			expect: map[string]string{"zstd": ""},
+		},
+		{
+			name:   "bzip2",
+			in:     bzip2Data,
+			expect: map[string]string{"bzip2": ""},
+		},
+		{
+			name: "tar.gz",
+			in: testGzip(t, testTar(t, map[string][]byte{
+				"logs/app.log":    []byte("{\"msg\":\"app\"}\n"),
+				"logs/old.log.gz": testGzip(t, []byte("{\"msg\":\"old\"}\n")),
+			})),
+			expect: map[string]string{"app": "logs/app.log", "old": "logs/old.log.gz"},
+		},
+		{
+			name:    "truncated gzip",
+			in:      testGzip(t, []byte("{\"msg\":\"gzip\"}\n"))[:12],
+			wantErr: true,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			db := testOpenDatabase(t)
+			err := scanArchive(bytes.NewReader(c.in), "", db)
+			if c.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			logs := testWaitLogs(t, db, len(c.expect))
+			got := map[string]string{}
+			for _, l := range logs {
+				source, _ := l.data["source"].(string)
+				got[l.message] = source
+			}
+			assert.Equal(t, c.expect, got)
+		})
+	}
+}
+
+func TestScanStream(t *testing.T) {
+	db := testOpenDatabase(t)
+	r, w := io.Pipe()
+	done := make(chan error)
+	go func() { done <- scanStream(r, db) }()
+
+	// a short line is ingested without waiting for more input
+	_, err := w.Write([]byte("{\"msg\":\"first\"}\n"))
+	assert.NoError(t, err)
+	logs := testWaitLogs(t, db, 1)
+	assert.Equal(t, "first", logs[0].message)
+
+	assert.NoError(t, w.Close())
+	assert.NoError(t, <-done)
+}
+
+func TestScanStreamCompressed(t *testing.T) {
+	db := testOpenDatabase(t)
+	r, w := io.Pipe()
+	go func() {
+		_, _ = w.Write(testGzip(t, []byte("{\"msg\":\"gzip\"}\n")))
+		w.Close()
+	}()
+	assert.NoError(t, scanStream(r, db))
+	logs := testWaitLogs(t, db, 1)
+	assert.Equal(t, "gzip", logs[0].message)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// drainWildcard replaces the variable tokens of a template.
+const drainWildcard = "<*>"
+
+// drain clusters messages into templates online, following the Drain
+// algorithm (He et al., 2017): messages are routed through a fixed-depth tree
+// by their token count and first tokens, then matched with the most similar
+// template of the leaf. Tokens that differ between the messages of a cluster
+// are replaced with <*>.
+type drain struct {
+	mu sync.Mutex
+	// depth is the number of leading tokens used to route messages.
+	depth int
+	// similarity is the minimum fraction of equal tokens for a message to
+	// join a cluster.
+	similarity float64
+	// maxChildren is the number of children of a node, after which tokens
+	// are routed to the wildcard child.
+	maxChildren int
+	root        map[int]*drainNode
+	nextID      int64
+}
+
+type drainNode struct {
+	children map[string]*drainNode
+	clusters []*drainCluster
+}
+
+type drainCluster struct {
+	id     int64
+	tokens []string
+}
+
+func newDrain() *drain {
+	return &drain{
+		depth:       1,
+		similarity:  0.5,
+		maxChildren: 100,
+		root:        map[int]*drainNode{},
+		nextID:      1,
+	}
+}
+
+// add clusters message and returns the ID of its template, and the template.
+// changed is true when the template was created or updated. Empty messages
+// return a zero ID.
+func (d *drain) add(message string) (id int64, template string, changed bool) {
+	tokens := strings.Fields(message)
+	if len(tokens) == 0 {
+		return 0, "", false
+	}
+	for i, token := range tokens {
+		if hasDigit(token) {
+			tokens[i] = drainWildcard
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	leaf := d.leaf(tokens)
+	var best *drainCluster
+	bestSimilarity := -1.0
+	for _, c := range leaf.clusters {
+		s := tokenSimilarity(c.tokens, tokens)
+		if s > bestSimilarity {
+			best, bestSimilarity = c, s
+		}
+	}
+
+	if best == nil || bestSimilarity < d.similarity {
+		c := &drainCluster{id: d.nextID, tokens: tokens}
+		d.nextID++
+		leaf.clusters = append(leaf.clusters, c)
+		return c.id, strings.Join(c.tokens, " "), true
+	}
+
+	for i, token := range tokens {
+		if best.tokens[i] != token && best.tokens[i] != drainWildcard {
+			best.tokens[i] = drainWildcard
+			changed = true
+		}
+	}
+	return best.id, strings.Join(best.tokens, " "), changed
+}
+
+// leaf returns the leaf node for tokens, creating the nodes on the way. It
+// must be called with d.mu held.
+func (d *drain) leaf(tokens []string) *drainNode {
+	node, ok := d.root[len(tokens)]
+	if !ok {
+		node = &drainNode{children: map[string]*drainNode{}}
+		d.root[len(tokens)] = node
+	}
+	for i := 0; i < d.depth && i < len(tokens); i++ {
+		token := tokens[i]
+		child, ok := node.children[token]
+		if !ok {
+			if len(node.children) >= d.maxChildren {
+				token = drainWildcard
+				child = node.children[token]
+			}
+			if child == nil {
+				child = &drainNode{children: map[string]*drainNode{}}
+				node.children[token] = child
+			}
+		}
+		node = child
+	}
+	return node
+}
+
+// tokenSimilarity returns the fraction of equal tokens in two sequences of
+// the same length.
+func tokenSimilarity(template, tokens []string) float64 {
+	equal := 0
+	for i := range tokens {
+		if template[i] == tokens[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(tokens))
+}
+
+func hasDigit(s string) bool {
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrain(t *testing.T) {
+	d := newDrain()
+
+	type step struct {
+		in       string
+		id       int64
+		template string
+		changed  bool
+	}
+	steps := []step{
+		{in: "It's 20:34:11.244", id: 1, template: "It's <*>", changed: true},
+		{in: "It's 20:34:12.001", id: 1, template: "It's <*>"},
+		{in: "user alice logged in", id: 2, template: "user alice logged in", changed: true},
+		{in: "user bob logged in", id: 2, template: "user <*> logged in", changed: true},
+		{in: "user carol logged in", id: 2, template: "user <*> logged in"},
+		{in: "user carol logged out after 5s", id: 3, template: "user carol logged out after <*>", changed: true},
+		{in: "connection reset by peer", id: 4, template: "connection reset by peer", changed: true},
+		{in: "connection refused", id: 5, template: "connection refused", changed: true},
+		{in: "   ", id: 0},
+	}
+	for _, s := range steps {
+		id, template, changed := d.add(s.in)
+		assert.Equal(t, s.id, id, s.in)
+		assert.Equal(t, s.template, template, s.in)
+		assert.Equal(t, s.changed, changed, s.in)
+	}
+}
+
+func TestDrainMaxChildren(t *testing.T) {
+	d := newDrain()
+	d.maxChildren = 2
+	ids := map[int64]bool{}
+	for _, word := range []string{"alpha", "beta", "gamma", "delta"} {
+		id, _, _ := d.add(word + " started")
+		ids[id] = true
+	}
+	// gamma and delta share the wildcard node, and their cluster
+	assert.Len(t, ids, 3)
+}
+
+func TestQueryTemplates(t *testing.T) {
+	db := testOpenDatabase(t)
+	start := time.Date(2023, time.July, 24, 18, 34, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		level := "info"
+		if i == 4 {
+			level = "error"
+		}
+		logJSON := fmt.Sprintf(`{"timestamp":"%s","level":"%s","msg":"request %d served"}`,
+			start.Add(time.Duration(i)*time.Second).Format(time.RFC3339), level, i)
+		assert.NoError(t, db.appendLog([]byte(logJSON)))
+	}
+	assert.NoError(t, db.appendLog([]byte(`{"timestamp":"2023-07-24T18:35:00Z","msg":"shutting down"}`)))
+	assert.NoError(t, db.appendLog([]byte(`{"timestamp":"2023-07-24T18:35:00Z","no":"message"}`)))
+
+	stats, err := db.queryTemplates(time.Time{}, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]templateStats{
+			{
+				id:       1,
+				template: "request <*> served",
+				count:    5,
+				first:    start,
+				last:     start.Add(4 * time.Second),
+				levels:   map[string]int{"info": 4, "error": 1},
+			},
+			{
+				id:       2,
+				template: "shutting down",
+				count:    1,
+				first:    start.Add(time.Minute),
+				last:     start.Add(time.Minute),
+				levels:   map[string]int{"": 1},
+			},
+		},
+		stats,
+	)
+
+	logs := testWaitLogs(t, db, 7)
+	c, err := parseCondition("@template == 1")
+	assert.NoError(t, err)
+	assert.Len(t, filterLogs(logs, c), 5)
+}
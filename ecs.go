@@ -0,0 +1,21 @@
+package main
+
+// isECS reports whether logData follows the Elastic Common Schema, with an
+// @timestamp and either the ECS version or a log.level field.
+func isECS(logData map[string]any) bool {
+	if _, ok := logData["@timestamp"]; !ok {
+		return false
+	}
+	if _, ok := lookupField(logData, "ecs.version"); ok {
+		return true
+	}
+	_, ok := lookupField(logData, "log.level")
+	return ok
+}
+
+// ecsFields reads the timestamp from @timestamp and the level from
+// log.level. The message is already in the message field.
+func ecsFields(logData map[string]any) schemaFields {
+	level, _ := lookupField(logData, "log.level")
+	return schemaFields{timestamp: logData["@timestamp"], level: level}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestECSFields(t *testing.T) {
+	nested := map[string]any{
+		"@timestamp": "2023-07-24T18:34:11.241Z",
+		"log":        map[string]any{"level": "warn"},
+		"message":    "slow query",
+		"service":    map[string]any{"name": "api"},
+		"ecs":        map[string]any{"version": "1.6.0"},
+	}
+	assert.True(t, isECS(nested))
+	assert.Equal(t, schemaFields{timestamp: "2023-07-24T18:34:11.241Z", level: "warn"}, ecsFields(nested))
+
+	dotted := map[string]any{
+		"@timestamp": "2023-07-24T18:34:11.241Z",
+		"log.level":  "ERROR",
+		"message":    "failed",
+	}
+	assert.True(t, isECS(dotted))
+	assert.Equal(t, "ERROR", ecsFields(dotted).level)
+
+	assert.False(t, isECS(map[string]any{"@timestamp": "2023-07-24T18:34:11.241Z", "message": "no ECS field"}))
+}
+
+func TestAppendECS(t *testing.T) {
+	db := testOpenDatabase(t)
+	err := db.appendLog([]byte(`{"@timestamp":"2023-07-24T18:34:11.241Z","log.level":"error","message":"failed","service":{"name":"api"},"ecs.version":"1.6.0"}`))
+	assert.NoError(t, err)
+
+	logs := testWaitLogs(t, db, 1)
+	assert.Equal(t, "failed", logs[0].message)
+	assert.Equal(t, severityError, logs[0].severity)
+	assert.Equal(t, time.Date(2023, time.July, 24, 18, 34, 11, 241000000, time.UTC), logs[0].timestamp.UTC())
+	// the log is stored as sent
+	assert.NotContains(t, logs[0].data, "timestamp")
+	assert.NotContains(t, logs[0].data, "level")
+
+	c, err := parseCondition("service.name == api")
+	assert.NoError(t, err)
+	assert.True(t, c.match(&logs[0]))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// criLine matches the CRI log format used by Kubernetes, e.g.
+// "2023-10-06T00:17:09.669794202Z stdout F message". The P tag marks a
+// partial line, continued in the next entry of the same stream.
+var criLine = regexp.MustCompile(`^(\S+) (stdout|stderr) ([PF]) ?(.*)$`)
+
+// dockerKeys are the keys of a docker json-file log entry.
+var dockerKeys = map[string]bool{"log": true, "stream": true, "time": true, "attrs": true}
+
+// envelopeDecoder unwraps logs written by container runtimes, in the docker
+// json-file or CRI formats, and reassembles lines split into partial entries.
+// Other lines are returned unchanged. A decoder must only be used for a
+// single input, since it keeps partial lines between calls.
+type envelopeDecoder struct {
+	// partials holds partial lines by stream.
+	partials map[string][]byte
+}
+
+func newEnvelopeDecoder() *envelopeDecoder {
+	return &envelopeDecoder{partials: map[string][]byte{}}
+}
+
+// appendLine unwraps the line and appends the complete logs to the database.
+func (d *envelopeDecoder) appendLine(db *DB, line []byte, fields map[string]any) error {
+	logJSON, complete, err := d.unwrap(line)
+	if err != nil {
+		return err
+	}
+	if !complete {
+		return nil
+	}
+	return appendLine(db, logJSON, fields)
+}
+
+// unwrap returns the log wrapped in line, with the envelope metadata merged
+// in. complete is false when line is a partial entry, which is kept until the
+// rest of the line is read.
+func (d *envelopeDecoder) unwrap(line []byte) ([]byte, bool, error) {
+	// trailing spaces are significant in partial CRI lines
+	line = bytes.TrimRight(line, "\r\n")
+
+	if m := criLine.FindSubmatch(line); m != nil {
+		ts, err := time.Parse(time.RFC3339Nano, string(m[1]))
+		if err == nil {
+			stream := string(m[2])
+			content := append(d.partials[stream], m[4]...)
+			if string(m[3]) == "P" {
+				d.partials[stream] = content
+				return nil, false, nil
+			}
+			delete(d.partials, stream)
+			logJSON, err := mergeEnvelope(content, stream, ts.Format(time.RFC3339Nano), nil)
+			return logJSON, true, err
+		}
+	}
+
+	line = bytes.TrimSpace(line)
+	if bytes.HasPrefix(line, []byte("{")) && bytes.Contains(line, []byte(`"log"`)) {
+		var envelope map[string]any
+		if json.Unmarshal(line, &envelope) == nil && isDockerEnvelope(envelope) {
+			stream, _ := envelope["stream"].(string)
+			content := append(d.partials[stream], envelope["log"].(string)...)
+			// docker splits long lines, and only the last part ends with a newline
+			if !bytes.HasSuffix(content, []byte("\n")) {
+				d.partials[stream] = content
+				return nil, false, nil
+			}
+			delete(d.partials, stream)
+			logJSON, err := mergeEnvelope(
+				bytes.TrimRight(content, "\r\n"),
+				stream,
+				envelope["time"],
+				envelope["attrs"],
+			)
+			return logJSON, true, err
+		}
+	}
+
+	return line, true, nil
+}
+
+func isDockerEnvelope(envelope map[string]any) bool {
+	if _, ok := envelope["log"].(string); !ok {
+		return false
+	}
+	for k := range envelope {
+		if !dockerKeys[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeEnvelope returns the log in content, adding the stream, the container
+// time and attributes of its envelope. Content that isn't a JSON object is
+// used as the message. The container time is the log timestamp if content
+// has none, and is kept in "container_time" otherwise.
+func mergeEnvelope(content []byte, stream string, containerTime any, attrs any) ([]byte, error) {
+	var logData map[string]any
+	if json.Unmarshal(content, &logData) != nil || logData == nil {
+		logData = map[string]any{"msg": string(content)}
+	}
+
+	if _, ok := logData["stream"]; !ok && stream != "" {
+		logData["stream"] = stream
+	}
+	if containerTime != nil {
+		if _, ok := findTimestamp(logData); ok {
+			logData["container_time"] = containerTime
+		} else {
+			logData["timestamp"] = containerTime
+		}
+	}
+	if _, ok := logData["attrs"]; !ok && attrs != nil {
+		logData["attrs"] = attrs
+	}
+
+	logJSON, err := json.Marshal(logData)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't unwrap container log: %w", err)
+	}
+	return logJSON, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelopeDecoder(t *testing.T) {
+	type testCase struct {
+		name   string
+		in     []string
+		expect []map[string]any
+	}
+	testCases := []testCase{
+		{
+			name: "plain JSON",
+			in:   []string{`{"log":"not an envelope","level":"info"}`},
+			expect: []map[string]any{
+				{"log": "not an envelope", "level": "info"},
+			},
+		},
+		{
+			name: "docker JSON payload",
+			in: []string{
+				`{"log":"{\"level\":\"info\",\"msg\":\"hello\"}\n","stream":"stdout","time":"2023-07-24T18:34:11.241Z"}`,
+			},
+			expect: []map[string]any{
+				{"level": "info", "msg": "hello", "stream": "stdout", "timestamp": "2023-07-24T18:34:11.241Z"},
+			},
+		},
+		{
+			name: "docker with inner timestamp and attrs",
+			in: []string{
+				`{"log":"{\"ts\":1690223651.241,\"msg\":\"hello\"}\n","stream":"stderr","time":"2023-07-24T18:34:11.5Z","attrs":{"tag":"api"}}`,
+			},
+			expect: []map[string]any{
+				{
+					"ts":             1690223651.241,
+					"msg":            "hello",
+					"stream":         "stderr",
+					"container_time": "2023-07-24T18:34:11.5Z",
+					"attrs":          map[string]any{"tag": "api"},
+				},
+			},
+		},
+		{
+			name: "docker partial lines",
+			in: []string{
+				`{"log":"{\"msg\":\"he","stream":"stdout","time":"2023-07-24T18:34:11.241Z"}`,
+				`{"log":"plain on stderr\n","stream":"stderr","time":"2023-07-24T18:34:11.242Z"}`,
+				`{"log":"llo\"}\n","stream":"stdout","time":"2023-07-24T18:34:11.243Z"}`,
+			},
+			expect: []map[string]any{
+				{"msg": "plain on stderr", "stream": "stderr", "timestamp": "2023-07-24T18:34:11.242Z"},
+				{"msg": "hello", "stream": "stdout", "timestamp": "2023-07-24T18:34:11.243Z"},
+			},
+		},
+		{
+			name: "CRI",
+			in: []string{
+				`2023-10-06T00:17:09.669794202Z stdout F {"level":"warn","msg":"slow"}`,
+				`2023-10-06T00:17:10Z stderr P partial `,
+				`2023-10-06T00:17:10.1Z stderr F line`,
+				`2023-10-06T00:17:11Z stdout F `,
+			},
+			expect: []map[string]any{
+				{"level": "warn", "msg": "slow", "stream": "stdout", "timestamp": "2023-10-06T00:17:09.669794202Z"},
+				{"msg": "partial line", "stream": "stderr", "timestamp": "2023-10-06T00:17:10.1Z"},
+				{"msg": "", "stream": "stdout", "timestamp": "2023-10-06T00:17:11Z"},
+			},
+		},
+		{
+			name:   "not CRI",
+			in:     []string{`yesterday stdout F hello`},
+			expect: nil,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			d := newEnvelopeDecoder()
+			var got []map[string]any
+			for _, line := range c.in {
+				logJSON, complete, err := d.unwrap([]byte(line))
+				assert.NoError(t, err)
+				if !complete {
+					continue
+				}
+				var logData map[string]any
+				if json.Unmarshal(logJSON, &logData) == nil {
+					got = append(got, logData)
+				}
+			}
+			assert.Equal(t, c.expect, got)
+		})
+	}
+}
+
+func TestEnvelopeDecoderAppendLine(t *testing.T) {
+	db := testOpenDatabase(t)
+	d := newEnvelopeDecoder()
+
+	err := d.appendLine(db, []byte(`2023-10-06T00:17:09Z stdout P {"level":"error",`), nil)
+	assert.NoError(t, err)
+	err = d.appendLine(db, []byte(`2023-10-06T00:17:09.5Z stdout F "msg":"joined"}`), nil)
+	assert.NoError(t, err)
+
+	logs := testWaitLogs(t, db, 1)
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "joined", logs[0].message)
+	assert.Equal(t, severityError, logs[0].severity)
+	assert.Equal(t, "2023-10-06T00:17:09.5Z", logs[0].timestamp.UTC().Format("2006-01-02T15:04:05.999Z"))
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// expr is an arithmetic expression on the fields of a log, such as
+// `elapsed_ns / 1e6` or `regex(msg, "GET (\S+)")`. It supports numbers,
+// quoted strings, field names, + - * / % with the usual precedence,
+// parentheses, and the functions listed in exprFunctions. Field names with
+// characters other than letters, digits, _, @ and dots are written
+// field("elapsed-time").
+type expr struct {
+	source string
+	root   exprNode
+}
+
+// exprNode evaluates to a float64, a string, or nil when a value is missing
+// or invalid, e.g. a field that isn't a number in an arithmetic operation.
+type exprNode interface {
+	eval(data map[string]any) any
+}
+
+type (
+	exprValue  struct{ value any }
+	exprField  struct{ name string }
+	exprNegate struct{ operand exprNode }
+	exprBinary struct {
+		op          byte
+		left, right exprNode
+	}
+	exprCall struct {
+		name string
+		args []exprNode
+		// re is the compiled pattern of regex.
+		re *regexp.Regexp
+	}
+)
+
+// exprFunctions maps the functions to their number of arguments.
+var exprFunctions = map[string]int{
+	// regex(value, "pattern") returns the first group matched by pattern,
+	// or the whole match if it has no groups.
+	"regex": 2,
+	// duration(value) parses a Go duration such as "1m4.61s", in seconds.
+	"duration": 1,
+	// number(value) parses a numeric string.
+	"number": 1,
+	// field("name") returns the field with the given name.
+	"field": 1,
+}
+
+// exprToken is a number, string, identifier or single-character operator.
+type exprToken struct {
+	kind byte // 'n', 's', 'i', or the operator
+	text string
+	num  float64
+}
+
+func parseExpr(s string) (*expr, error) {
+	tokens, err := tokenizeExpr(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression \"%s\": %w", s, err)
+	}
+	p := exprParser{tokens: tokens}
+	root, err := p.parseSum()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected \"%s\"", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression \"%s\": %w", s, err)
+	}
+	return &expr{source: s, root: root}, nil
+}
+
+func isExprIdent(r rune, first bool) bool {
+	if unicode.IsLetter(r) || r == '_' || r == '@' {
+		return true
+	}
+	return !first && (unicode.IsDigit(r) || r == '.')
+}
+
+func tokenizeExpr(s string) ([]exprToken, error) {
+	tokens := []exprToken{}
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("+-*/%(),", r):
+			tokens = append(tokens, exprToken{kind: byte(r), text: string(r)})
+			i++
+		case r == '"' || r == '\'':
+			// a backslash only escapes the quote, so that regular
+			// expressions can be written as is
+			builder := strings.Builder{}
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) && runes[j+1] == r {
+					j++
+				}
+				builder.WriteRune(runes[j])
+			}
+			if j == len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, exprToken{kind: 's', text: builder.String()})
+			i = j + 1
+		case unicode.IsDigit(r) || r == '.':
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			if j < len(runes) && (runes[j] == 'e' || runes[j] == 'E') {
+				j++
+				if j < len(runes) && (runes[j] == '+' || runes[j] == '-') {
+					j++
+				}
+				for j < len(runes) && unicode.IsDigit(runes[j]) {
+					j++
+				}
+			}
+			text := string(runes[i:j])
+			n, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number \"%s\"", text)
+			}
+			tokens = append(tokens, exprToken{kind: 'n', text: text, num: n})
+			i = j
+		case isExprIdent(r, true):
+			j := i + 1
+			for j < len(runes) && isExprIdent(runes[j], false) {
+				j++
+			}
+			tokens = append(tokens, exprToken{kind: 'i', text: string(runes[i:j])})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected \"%c\"", r)
+		}
+	}
+	return tokens, nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+// accept consumes the next token if it is one of the operators in ops.
+func (p *exprParser) accept(ops string) (byte, bool) {
+	if p.pos < len(p.tokens) && strings.IndexByte(ops, p.tokens[p.pos].kind) >= 0 {
+		p.pos++
+		return p.tokens[p.pos-1].kind, true
+	}
+	return 0, false
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	left, err := p.parseProduct()
+	for err == nil {
+		op, ok := p.accept("+-")
+		if !ok {
+			break
+		}
+		var right exprNode
+		right, err = p.parseProduct()
+		left = exprBinary{op: op, left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	left, err := p.parseUnary()
+	for err == nil {
+		op, ok := p.accept("*/%")
+		if !ok {
+			break
+		}
+		var right exprNode
+		right, err = p.parseUnary()
+		left = exprBinary{op: op, left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.parseUnary()
+		return exprNegate{operand: operand}, err
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end")
+	}
+	if _, ok := p.accept("("); ok {
+		node, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, fmt.Errorf("missing \")\"")
+		}
+		return node, nil
+	}
+
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case 'n':
+		return exprValue{value: t.num}, nil
+	case 's':
+		return exprValue{value: t.text}, nil
+	case 'i':
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(t.text)
+		}
+		return exprField{name: t.text}, nil
+	}
+	return nil, fmt.Errorf("unexpected \"%s\"", t.text)
+}
+
+// parseCall parses the arguments of a function, after the opening
+// parenthesis.
+func (p *exprParser) parseCall(name string) (exprNode, error) {
+	arity, ok := exprFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function \"%s\"", name)
+	}
+	call := exprCall{name: name}
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.parseSum()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if _, ok := p.accept(")"); ok {
+				break
+			}
+			if _, ok := p.accept(","); !ok {
+				return nil, fmt.Errorf("missing \")\" after arguments of %s", name)
+			}
+		}
+	}
+	if len(call.args) != arity {
+		return nil, fmt.Errorf("%s takes %d arguments", name, arity)
+	}
+
+	switch name {
+	case "regex":
+		literal, _ := call.args[1].(exprValue)
+		pattern, ok := literal.value.(string)
+		if !ok {
+			return nil, fmt.Errorf("the pattern of regex must be a string")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		call.re = re
+	case "field":
+		literal, _ := call.args[0].(exprValue)
+		fieldName, ok := literal.value.(string)
+		if !ok {
+			return nil, fmt.Errorf("the name of field must be a string")
+		}
+		return exprField{name: fieldName}, nil
+	}
+	return call, nil
+}
+
+// eval returns the value of the expression for a log, or nil.
+func (e *expr) eval(data map[string]any) any {
+	v := e.root.eval(data)
+	if n, ok := v.(float64); ok && (math.IsNaN(n) || math.IsInf(n, 0)) {
+		// not representable in JSON
+		return nil
+	}
+	return v
+}
+
+func (n exprValue) eval(data map[string]any) any {
+	return n.value
+}
+
+func (n exprField) eval(data map[string]any) any {
+	v, ok := lookupField(data, n.name)
+	if !ok {
+		return nil
+	}
+	switch v.(type) {
+	case float64, string:
+		return v
+	case bool:
+		return fieldString(v)
+	}
+	return nil
+}
+
+func (n exprNegate) eval(data map[string]any) any {
+	if x, ok := fieldNumber(n.operand.eval(data)); ok {
+		return -x
+	}
+	return nil
+}
+
+func (n exprBinary) eval(data map[string]any) any {
+	x, ok := fieldNumber(n.left.eval(data))
+	if !ok {
+		return nil
+	}
+	y, ok := fieldNumber(n.right.eval(data))
+	if !ok {
+		return nil
+	}
+	switch n.op {
+	case '+':
+		return x + y
+	case '-':
+		return x - y
+	case '*':
+		return x * y
+	case '/':
+		return x / y
+	case '%':
+		return math.Mod(x, y)
+	}
+	return nil
+}
+
+func (n exprCall) eval(data map[string]any) any {
+	arg := n.args[0].eval(data)
+	if arg == nil {
+		return nil
+	}
+	switch n.name {
+	case "regex":
+		m := n.re.FindStringSubmatch(fieldString(arg))
+		if m == nil {
+			return nil
+		}
+		if len(m) > 1 {
+			return m[1]
+		}
+		return m[0]
+	case "duration":
+		s, ok := arg.(string)
+		if !ok {
+			return nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil
+		}
+		return d.Seconds()
+	case "number":
+		if x, ok := fieldNumber(arg); ok {
+			return x
+		}
+	}
+	return nil
+}
+
+// derivedFieldConfig is a computed field as written in the config file.
+type derivedFieldConfig struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"`
+}
+
+// derivedField is a field computed from the other fields of each log when it
+// is appended.
+type derivedField struct {
+	name string
+	expr *expr
+}
+
+// derivedFieldName matches the names of derived fields, which are used in
+// SQL index names and JSON paths.
+var derivedFieldName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// newDerivedFields parses the derived fields from the config file.
+func newDerivedFields(configs []derivedFieldConfig) ([]derivedField, error) {
+	fields := make([]derivedField, 0, len(configs))
+	for _, fc := range configs {
+		if !derivedFieldName.MatchString(fc.Name) {
+			return nil, fmt.Errorf("invalid derived field name: \"%s\"", fc.Name)
+		}
+		e, err := parseExpr(fc.Expr)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, derivedField{name: fc.Name, expr: e})
+	}
+	return fields, nil
+}
+
+// addDerivedFields sets the derived fields of a log, in order, so that a
+// derived field can use the previous ones. Fields evaluating to nil are
+// omitted. It returns whether a field was set.
+func addDerivedFields(logData map[string]any, fields []derivedField) bool {
+	changed := false
+	for _, f := range fields {
+		if v := f.expr.eval(logData); v != nil {
+			logData[f.name] = v
+			changed = true
+		}
+	}
+	return changed
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExprErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"a +",
+		"(a",
+		"a b",
+		"1.2.3",
+		`"open`,
+		"unknown(a)",
+		"regex(msg)",
+		"regex(msg, pattern)",
+		`regex(msg, "(")`,
+		"field(name)",
+		"a # b",
+	} {
+		t.Run(in, func(t *testing.T) {
+			_, err := parseExpr(in)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestExprEval(t *testing.T) {
+	data := map[string]any{
+		"elapsed_ns":   float64(1500000),
+		"count":        "12",
+		"msg":          "GET /api/users 200",
+		"elapsed-time": "1m4.610023074s",
+		"http":         map[string]any{"status": float64(503)},
+		"ok":           true,
+	}
+	for _, c := range []struct {
+		in     string
+		expect any
+	}{
+		{"elapsed_ns / 1e6", 1.5},
+		{"1 + 2 * 3 - 4 / 2", float64(5)},
+		{"(1 + 2) * 3", float64(9)},
+		{"-count + 2", float64(-10)},
+		{"count % 5", float64(2)},
+		{"http.status / 100", 5.03},
+		{`regex(msg, "GET (\S+)")`, "/api/users"},
+		{`regex(msg, '\d+$')`, "200"},
+		{`regex(msg, "POST (\S+)")`, nil},
+		{`number(regex(msg, "(\d+)$")) + 1`, float64(201)},
+		{`duration(field("elapsed-time"))`, 64.610023074},
+		{"duration(msg)", nil},
+		{"missing * 2", nil},
+		{"msg * 2", nil},
+		{"elapsed_ns / 0", nil},
+		{`regex(ok, "true")`, "true"},
+		{`"text"`, "text"},
+	} {
+		t.Run(c.in, func(t *testing.T) {
+			e, err := parseExpr(c.in)
+			if !assert.NoError(t, err) {
+				return
+			}
+			if n, ok := c.expect.(float64); ok {
+				assert.InDelta(t, n, e.eval(data), 1e-9)
+			} else {
+				assert.Equal(t, c.expect, e.eval(data))
+			}
+		})
+	}
+}
+
+func TestNewDerivedFieldsErrors(t *testing.T) {
+	for _, fc := range []derivedFieldConfig{
+		{Name: "", Expr: "a"},
+		{Name: "route-name", Expr: "a"},
+		{Name: "route", Expr: "a +"},
+	} {
+		_, err := newDerivedFields([]derivedFieldConfig{fc})
+		assert.Error(t, err, fc)
+	}
+}
+
+func TestAppendDerivedFields(t *testing.T) {
+	db := testOpenDatabase(t)
+	derived, err := newDerivedFields([]derivedFieldConfig{
+		{Name: "elapsed_s", Expr: `duration(field("elapsed-time"))`},
+		{Name: "elapsed_ms", Expr: "elapsed_s * 1000"},
+		{Name: "route", Expr: `regex(msg, "GET (\S+)")`},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	db.derived = derived
+
+	assert.NoError(t, db.appendLog([]byte(`{"msg":"GET /users","elapsed-time":"1.5s"}`)))
+	assert.NoError(t, db.appendLog([]byte(`{"msg":"done"}`)))
+
+	logs, err := db.queryLogs(time.Time{}, time.Now())
+	assert.NoError(t, err)
+	if !assert.Len(t, logs, 2) {
+		return
+	}
+	byMessage := map[string]log{}
+	for _, l := range logs {
+		byMessage[l.message] = l
+	}
+	assert.Equal(
+		t,
+		map[string]any{
+			"msg":          "GET /users",
+			"elapsed-time": "1.5s",
+			"elapsed_s":    1.5,
+			"elapsed_ms":   float64(1500),
+			"route":        "/users",
+		},
+		byMessage["GET /users"].data,
+	)
+	assert.Equal(t, map[string]any{"msg": "done"}, byMessage["done"].data)
+
+	// derived fields are indexed like other fields
+	var count int
+	err = db.sqlDB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'logs__route'").
+		Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
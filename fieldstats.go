@@ -0,0 +1,255 @@
+package main
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// Field types, as inferred from the values of a field. Strings that parse as
+// numbers, durations or RFC3339 timestamps are counted as such.
+const (
+	typeString    = "string"
+	typeNumber    = "number"
+	typeBool      = "bool"
+	typeObject    = "object"
+	typeArray     = "array"
+	typeDuration  = "duration"
+	typeTimestamp = "timestamp"
+)
+
+const (
+	// sketchSize is the number of smallest value hashes kept to estimate
+	// the number of distinct values of a field.
+	sketchSize = 256
+	// reservoirSize is the number of numeric values sampled to estimate
+	// percentiles.
+	reservoirSize = 1024
+	// maxFields is the number of fields observed, so that logs with dynamic
+	// keys, such as maps keyed by ID, don't grow the statistics without
+	// bound.
+	maxFields = 1000
+)
+
+// fieldCollector observes the fields of appended logs.
+type fieldCollector struct {
+	mu     sync.Mutex
+	logs   int
+	fields map[string]*fieldObserver
+	// untracked counts the values of the fields seen after maxFields
+	// others, which aren't observed.
+	untracked int
+	rand      *rand.Rand
+}
+
+// fieldObserver accumulates the values of one field.
+type fieldObserver struct {
+	// present counts the logs with the field, including null values.
+	present int
+	nulls   int
+	types   map[string]int
+	// hashes holds the sketchSize smallest hashes of the values, sorted.
+	hashes []uint64
+	// numbers counts numeric values, sampled in reservoir.
+	numbers   int
+	min, max  float64
+	reservoir []float64
+}
+
+// fieldSummary is the statistics of a field shown in the fields page.
+type fieldSummary struct {
+	name  string
+	types map[string]int
+	// nullRate is the fraction of logs where the field is missing or null.
+	nullRate float64
+	// distinct is an estimate of the number of distinct values.
+	distinct int
+	// numbers is the number of numeric values, which the other figures
+	// describe.
+	numbers                 int
+	min, max, p50, p90, p99 float64
+}
+
+func newFieldCollector() *fieldCollector {
+	return &fieldCollector{fields: map[string]*fieldObserver{}, rand: rand.New(rand.NewSource(1))}
+}
+
+// observe records the fields of a log. Nested objects are recorded both as
+// objects and field by field, with dotted names.
+func (fc *fieldCollector) observe(logData map[string]any) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.logs++
+	fc.observeObject("", logData)
+}
+
+func (fc *fieldCollector) observeObject(prefix string, data map[string]any) {
+	for name, v := range data {
+		name = prefix + name
+		fo, ok := fc.fields[name]
+		if !ok && len(fc.fields) < maxFields {
+			fo = &fieldObserver{types: map[string]int{}}
+			fc.fields[name] = fo
+		}
+		if fo != nil {
+			fo.observe(v, fc.rand)
+		} else {
+			fc.untracked++
+		}
+		if child, ok := v.(map[string]any); ok {
+			fc.observeObject(name+".", child)
+		}
+	}
+}
+
+func (fo *fieldObserver) observe(v any, r *rand.Rand) {
+	fo.present++
+	if v == nil {
+		fo.nulls++
+		return
+	}
+	fo.types[valueType(v)]++
+	if _, ok := v.(map[string]any); !ok {
+		fo.addHash(fieldString(v))
+	}
+
+	n, ok := fieldNumber(v)
+	if !ok {
+		return
+	}
+	fo.numbers++
+	if fo.numbers == 1 || n < fo.min {
+		fo.min = n
+	}
+	if fo.numbers == 1 || n > fo.max {
+		fo.max = n
+	}
+	if len(fo.reservoir) < reservoirSize {
+		fo.reservoir = append(fo.reservoir, n)
+	} else if i := r.Intn(fo.numbers); i < reservoirSize {
+		fo.reservoir[i] = n
+	}
+}
+
+// valueType returns the inferred type of a JSON value.
+func valueType(v any) string {
+	switch v := v.(type) {
+	case float64:
+		return typeNumber
+	case bool:
+		return typeBool
+	case map[string]any:
+		return typeObject
+	case []any:
+		return typeArray
+	case string:
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return typeNumber
+		}
+		if _, err := time.ParseDuration(v); err == nil {
+			return typeDuration
+		}
+		if _, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return typeTimestamp
+		}
+	}
+	return typeString
+}
+
+// addHash adds a value to the distinct values sketch, which keeps the
+// smallest hashes of the values.
+func (fo *fieldObserver) addHash(s string) {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	hash := mix64(h.Sum64())
+
+	i, found := slices.BinarySearch(fo.hashes, hash)
+	if found || i >= sketchSize {
+		return
+	}
+	fo.hashes = slices.Insert(fo.hashes, i, hash)
+	if len(fo.hashes) > sketchSize {
+		fo.hashes = fo.hashes[:sketchSize]
+	}
+}
+
+// mix64 spreads the bits of an FNV hash, whose high bits vary little between
+// similar short strings, with the MurmurHash3 finalizer.
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// distinct estimates the number of distinct values from the sketch: when
+// hashes are uniform, the k-th smallest of n distinct hashes is about k/n of
+// the hash range.
+func (fo *fieldObserver) distinct() int {
+	if len(fo.hashes) < sketchSize {
+		return len(fo.hashes)
+	}
+	kth := float64(fo.hashes[sketchSize-1]) / math.MaxUint64
+	return int(float64(sketchSize-1) / kth)
+}
+
+// summaries returns the statistics of every field, by name.
+func (fc *fieldCollector) summaries() []fieldSummary {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	summaries := make([]fieldSummary, 0, len(fc.fields))
+	for name, fo := range fc.fields {
+		s := fieldSummary{
+			name:     name,
+			types:    make(map[string]int, len(fo.types)),
+			nullRate: float64(fc.logs-fo.present+fo.nulls) / float64(fc.logs),
+			distinct: fo.distinct(),
+			numbers:  fo.numbers,
+			min:      fo.min,
+			max:      fo.max,
+		}
+		for t, count := range fo.types {
+			s.types[t] = count
+		}
+		if len(fo.reservoir) > 0 {
+			sorted := append([]float64{}, fo.reservoir...)
+			slices.Sort(sorted)
+			s.p50 = percentile(sorted, 0.5)
+			s.p90 = percentile(sorted, 0.9)
+			s.p99 = percentile(sorted, 0.99)
+		}
+		summaries = append(summaries, s)
+	}
+	slices.SortFunc(summaries, func(a, b fieldSummary) bool { return a.name < b.name })
+	return summaries
+}
+
+// untrackedValues returns the number of values of the fields that aren't
+// observed, beyond maxFields.
+func (fc *fieldCollector) untrackedValues() int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.untracked
+}
+
+// isNumeric returns whether the field holds numbers, possibly written as
+// strings, in most of the logs where it isn't null.
+func (fc *fieldCollector) isNumeric(name string) bool {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fo, ok := fc.fields[name]
+	return ok && fo.numbers*2 > fo.present-fo.nulls
+}
+
+// percentile returns the value at rank p, between 0 and 1, of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	return sorted[int(math.Round(p*float64(len(sorted)-1)))]
+}
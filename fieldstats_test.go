@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldCollector(t *testing.T) {
+	fc := newFieldCollector()
+	for i := 1; i <= 100; i++ {
+		logData := map[string]any{
+			"status":  float64(200),
+			"elapsed": fmt.Sprintf("%dms", i),
+			"bytes":   float64(i),
+			"http":    map[string]any{"path": fmt.Sprintf("/items/%d", i%10)},
+		}
+		if i%4 == 0 {
+			logData["bytes"] = nil
+		}
+		if i%2 == 0 {
+			logData["user"] = "ada"
+			logData["at"] = "2023-07-24T18:34:00Z"
+		}
+		fc.observe(logData)
+	}
+
+	summaries := map[string]fieldSummary{}
+	for _, s := range fc.summaries() {
+		summaries[s.name] = s
+	}
+	assert.Len(t, summaries, 7)
+
+	assert.Equal(t, map[string]int{"number": 100}, summaries["status"].types)
+	assert.Equal(t, 1, summaries["status"].distinct)
+	assert.Equal(t, float64(0), summaries["status"].nullRate)
+
+	assert.Equal(t, map[string]int{"duration": 100}, summaries["elapsed"].types)
+	assert.Equal(t, 100, summaries["elapsed"].distinct)
+	assert.Equal(t, map[string]int{"timestamp": 50}, summaries["at"].types)
+	assert.Equal(t, map[string]int{"object": 100}, summaries["http"].types)
+	assert.Equal(t, 10, summaries["http.path"].distinct)
+	assert.Equal(t, 0.5, summaries["user"].nullRate)
+
+	bytes := summaries["bytes"]
+	assert.Equal(t, 0.25, bytes.nullRate)
+	assert.Equal(t, 75, bytes.numbers)
+	assert.Equal(t, float64(1), bytes.min)
+	assert.Equal(t, float64(99), bytes.max)
+	assert.Equal(t, float64(50), bytes.p50)
+	assert.Equal(t, float64(90), bytes.p90)
+	assert.Equal(t, float64(98), bytes.p99)
+
+	assert.True(t, fc.isNumeric("bytes"))
+	assert.False(t, fc.isNumeric("elapsed"))
+	assert.False(t, fc.isNumeric("missing"))
+}
+
+func TestFieldCollectorDistinctEstimate(t *testing.T) {
+	fc := newFieldCollector()
+	for i := 0; i < 20000; i++ {
+		fc.observe(map[string]any{"id": fmt.Sprintf("request-%d", i%10000)})
+	}
+	s := fc.summaries()
+	if assert.Len(t, s, 1) {
+		assert.InEpsilon(t, 10000, s[0].distinct, 0.2)
+	}
+}
+
+func TestFieldCollectorMaxFields(t *testing.T) {
+	fc := newFieldCollector()
+	for i := 0; i < maxFields+10; i++ {
+		fc.observe(map[string]any{"msg": "request", "requests": map[string]any{fmt.Sprint(i): float64(i)}})
+	}
+	assert.Len(t, fc.summaries(), maxFields)
+	// msg and requests are tracked first, then maxFields-2 request IDs
+	assert.Equal(t, 12, fc.untrackedValues())
+	assert.True(t, fc.isNumeric("requests.0"))
+}
+
+func TestQueryLogsSorted(t *testing.T) {
+	db := testOpenDatabase(t)
+	start := time.Date(2023, time.July, 24, 18, 34, 0, 0, time.UTC)
+	for i, status := range []string{`"9"`, `"10"`, `null`, `"200"`} {
+		logJSON := fmt.Sprintf(`{"timestamp":"%s","status":%s,"user":"%c"}`,
+			start.Add(time.Duration(i)*time.Second).Format(time.RFC3339), status, 'd'-i)
+		assert.NoError(t, db.appendLog([]byte(logJSON)))
+	}
+
+	ids := func(logs []log) []int64 {
+		ids := []int64{}
+		for _, l := range logs {
+			ids = append(ids, l.id)
+		}
+		return ids
+	}
+
+	logs, err := db.queryLogsSorted(time.Time{}, time.Now(), "status")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{4, 2, 1, 3}, ids(logs))
+
+	logs, err = db.queryLogsSorted(time.Time{}, time.Now(), "user")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{4, 3, 2, 1}, ids(logs))
+}
+
+func TestJSONPaths(t *testing.T) {
+	assert.Equal(t, []string{"$.status"}, jsonPaths("status"))
+	assert.Equal(t, []string{`$."http.status-code"`, `$.http."status-code"`}, jsonPaths("http.status-code"))
+	assert.Equal(t, []string{`$."a.b.c"`, `$.a."b.c"`, "$.a.b.c", `$."a.b".c`}, jsonPaths("a.b.c"))
+	assert.Equal(t, []string{`$."a.b.c.d.e.f"`, "$.a.b.c.d.e.f"}, jsonPaths("a.b.c.d.e.f"))
+}
+
+func TestQueryLogsSortedDottedField(t *testing.T) {
+	db := testOpenDatabase(t)
+	for i, logJSON := range []string{
+		`{"timestamp":"2023-07-24T18:34:00Z","log.level":"b"}`,
+		`{"timestamp":"2023-07-24T18:34:01Z","log":{"level":"c"}}`,
+		`{"timestamp":"2023-07-24T18:34:02Z","log.level":"a"}`,
+		`{"timestamp":"2023-07-24T18:34:03Z","msg":"no level"}`,
+	} {
+		assert.NoError(t, db.appendLog([]byte(logJSON)), i)
+	}
+
+	logs, err := db.queryLogsSorted(time.Time{}, time.Now(), "log.level")
+	assert.NoError(t, err)
+	ids := []int64{}
+	for _, l := range logs {
+		ids = append(ids, l.id)
+	}
+	assert.Equal(t, []int64{3, 1, 2, 4}, ids)
+}
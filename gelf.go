@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	gelfChunkMagic = []byte{0x1e, 0x0f}
+	zlibMagic      = []byte{0x78}
+)
+
+const (
+	// gelfChunkHeaderSize is the size of the magic bytes, message ID,
+	// sequence number and sequence count of a GELF chunk.
+	gelfChunkHeaderSize = 12
+	// gelfMaxChunks is the largest number of chunks in a GELF message.
+	gelfMaxChunks = 128
+	// gelfChunkTimeout is how long the chunks of a message are kept, waiting
+	// for the missing ones.
+	gelfChunkTimeout = 5 * time.Second
+)
+
+// isGELF reports whether logData is a GELF message, with a short_message and
+// either a version or a host.
+func isGELF(logData map[string]any) bool {
+	if _, ok := logData["short_message"]; !ok {
+		return false
+	}
+	_, hasVersion := logData["version"]
+	_, hasHost := logData["host"]
+	return hasVersion || hasHost
+}
+
+// gelfFields reads the message from short_message. The numeric level is a
+// syslog severity, and the timestamp is in seconds, which are both parsed as
+// is.
+func gelfFields(logData map[string]any) schemaFields {
+	return schemaFields{message: logData["short_message"]}
+}
+
+// gelfMessage holds the chunks received for a GELF message.
+type gelfMessage struct {
+	chunks   [][]byte
+	received int
+	first    time.Time
+}
+
+// gelfAssembler reassembles chunked GELF messages received over UDP.
+type gelfAssembler struct {
+	mu       sync.Mutex
+	messages map[string]*gelfMessage
+}
+
+func newGELFAssembler() *gelfAssembler {
+	return &gelfAssembler{messages: map[string]*gelfMessage{}}
+}
+
+// isGELFChunk reports whether datagram is a chunk of a GELF message.
+func isGELFChunk(datagram []byte) bool {
+	return len(datagram) >= gelfChunkHeaderSize && bytes.HasPrefix(datagram, gelfChunkMagic)
+}
+
+// add stores a chunk, and returns the message once all of its chunks have
+// been received. Incomplete messages are dropped after gelfChunkTimeout.
+func (a *gelfAssembler) add(chunk []byte, now time.Time) ([]byte, bool, error) {
+	if !isGELFChunk(chunk) {
+		return nil, false, fmt.Errorf("invalid GELF chunk")
+	}
+	id := string(chunk[2:10])
+	seq, count := int(chunk[10]), int(chunk[11])
+	if count == 0 || count > gelfMaxChunks || seq >= count {
+		return nil, false, fmt.Errorf("invalid GELF chunk %d of %d", seq, count)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for k, m := range a.messages {
+		if now.Sub(m.first) > gelfChunkTimeout {
+			delete(a.messages, k)
+		}
+	}
+
+	m, ok := a.messages[id]
+	if !ok {
+		m = &gelfMessage{chunks: make([][]byte, count), first: now}
+		a.messages[id] = m
+	}
+	if len(m.chunks) != count {
+		delete(a.messages, id)
+		return nil, false, fmt.Errorf("inconsistent GELF chunk count")
+	}
+	if m.chunks[seq] == nil {
+		m.chunks[seq] = append([]byte{}, chunk[gelfChunkHeaderSize:]...)
+		m.received++
+	}
+	if m.received < count {
+		return nil, false, nil
+	}
+
+	delete(a.messages, id)
+	return bytes.Join(m.chunks, nil), true, nil
+}
+
+// decompressGELF decompresses a GELF payload compressed with gzip or zlib.
+// Uncompressed payloads are returned as is.
+func decompressGELF(data []byte) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case bytes.HasPrefix(data, zlibMagic):
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed GELF message: %w", err)
+	}
+	defer r.Close()
+
+	decompressed, err := io.ReadAll(io.LimitReader(r, maxRequestSize))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed GELF message: %w", err)
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGELFFields(t *testing.T) {
+	in := map[string]any{
+		"version":       "1.1",
+		"host":          "example.org",
+		"short_message": "A short message",
+		"full_message":  "Backtrace here\n\nmore stuff",
+		"timestamp":     1385053862.3072,
+		"level":         float64(1),
+		"_user_id":      float64(9001),
+		"_host":         "shadowed",
+	}
+	assert.True(t, isGELF(in))
+	assert.Equal(t, schemaFields{message: "A short message"}, gelfFields(in))
+
+	assert.False(t, isGELF(map[string]any{"short_message": "no version or host"}))
+}
+
+func TestAppendGELF(t *testing.T) {
+	db := testOpenDatabase(t)
+	err := db.appendLog([]byte(`{"version":"1.1","host":"web-1","short_message":"disk full","timestamp":1690223651.5,"level":2,"_app":"api"}`))
+	assert.NoError(t, err)
+
+	logs := testWaitLogs(t, db, 1)
+	assert.Equal(t, "disk full", logs[0].message)
+	assert.Equal(t, severityCritical, logs[0].severity)
+	assert.Equal(t, time.Date(2023, time.July, 24, 18, 34, 11, 500000000, time.UTC), logs[0].timestamp.UTC())
+	// the log is stored as sent
+	assert.Equal(t, "api", logs[0].data["_app"])
+	assert.NotContains(t, logs[0].data, "msg")
+}
+
+// testGELFChunks splits data into GELF chunks of size bytes.
+func testGELFChunks(id string, data []byte, size int) [][]byte {
+	count := (len(data) + size - 1) / size
+	chunks := [][]byte{}
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := append([]byte{0x1e, 0x0f}, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunks = append(chunks, append(chunk, data[i*size:end]...))
+	}
+	return chunks
+}
+
+func TestGELFAssembler(t *testing.T) {
+	a := newGELFAssembler()
+	now := time.Now()
+	chunks := testGELFChunks("abcdefgh", []byte(`{"short_message":"chunked","host":"h"}`), 10)
+
+	// chunks may arrive in any order, and twice
+	for i := len(chunks) - 1; i > 0; i-- {
+		msg, complete, err := a.add(chunks[i], now)
+		assert.NoError(t, err)
+		assert.False(t, complete)
+		assert.Nil(t, msg)
+	}
+	_, complete, _ := a.add(chunks[1], now)
+	assert.False(t, complete)
+	msg, complete, err := a.add(chunks[0], now)
+	assert.NoError(t, err)
+	assert.True(t, complete)
+	assert.Equal(t, `{"short_message":"chunked","host":"h"}`, string(msg))
+	assert.Empty(t, a.messages)
+
+	// incomplete messages expire
+	a.add(chunks[0], now)
+	a.add(testGELFChunks("otherone", []byte("{}"), 1)[0], now.Add(gelfChunkTimeout+time.Second))
+	assert.Len(t, a.messages, 1)
+
+	_, _, err = a.add([]byte{0x1e, 0x0f, 1, 2, 3, 4, 5, 6, 7, 8, 3, 2, 'x'}, now)
+	assert.Error(t, err)
+	_, _, err = a.add([]byte{0x1e, 0x0f, 1, 2, 3, 4, 5, 6, 7, 8, 0, 200, 'x'}, now)
+	assert.Error(t, err)
+}
+
+func TestListenUDPGELF(t *testing.T) {
+	db := testOpenDatabase(t)
+
+	addr, closer, err := listen("udp://127.0.0.1:0", db)
+	if err != nil {
+		t.Fatalf("unexpected error listening: %s", err)
+	}
+	defer closer.Close()
+
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatalf("unexpected error connecting: %s", err)
+	}
+	defer conn.Close()
+
+	buf := bytes.Buffer{}
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte(`{"version":"1.1","host":"web-1","short_message":"compressed and chunked","level":4}`))
+	zw.Close()
+	for _, chunk := range testGELFChunks("12345678", buf.Bytes(), 16) {
+		_, err = conn.Write(chunk)
+		assert.NoError(t, err)
+	}
+
+	logs := testWaitLogs(t, db, 1)
+	assert.Equal(t, "compressed and chunked", logs[0].message)
+	assert.Equal(t, severityWarn, logs[0].severity)
+}
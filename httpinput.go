@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// maxRequestSize is the largest request body accepted by the HTTP server.
+const maxRequestSize = 64 << 20
+
+// ingestError reports a log of a request that couldn't be appended. index is
+// the position of the log in the request.
+type ingestError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+type ingestResponse struct {
+	Accepted int           `json:"accepted"`
+	Errors   []ingestError `json:"errors"`
+}
+
+// serveHTTP starts an HTTP server accepting logs at address, e.g. ":9880".
+func serveHTTP(address string, db *DB) (net.Addr, io.Closer, error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't listen on %s: %w", address, err)
+	}
+	slog.Info("serving HTTP", "address", l.Addr())
+
+	server := &http.Server{Handler: newHTTPHandler(db)}
+	go func() {
+		err := server.Serve(l)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP server error", "error", err)
+		}
+	}()
+	return l.Addr(), server, nil
+}
+
+// newHTTPHandler returns a handler accepting POSTed logs as JSON arrays,
+// newline-delimited JSON, Loki push requests (JSON form) on
+// /loki/api/v1/push, OTLP/JSON logs on /v1/logs and Elasticsearch bulk
+// requests on /_bulk.
+func newHTTPHandler(db *DB) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/loki/api/v1/push", func(w http.ResponseWriter, r *http.Request) {
+		handleIngest(w, r, db, ingestLoki)
+	})
+	mux.HandleFunc("/v1/logs", func(w http.ResponseWriter, r *http.Request) {
+		handleIngest(w, r, db, ingestOTLP)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_bulk" || strings.HasSuffix(r.URL.Path, "/_bulk") {
+			handleIngest(w, r, db, ingestBulk)
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/" {
+			// Elasticsearch clients check the server version before sending
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"name":"ltop","version":{"number":"8.0.0"}}`)
+			return
+		}
+		handleIngest(w, r, db, ingestJSON)
+	})
+	return mux
+}
+
+type ingestFunc func(w http.ResponseWriter, body []byte, db *DB, fields map[string]any)
+
+func handleIngest(w http.ResponseWriter, r *http.Request, db *DB, ingest ingestFunc) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if strings.Contains(r.Header.Get("Content-Type"), "protobuf") {
+		http.Error(w, "only JSON payloads are supported", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, "invalid gzip body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, maxRequestSize)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, "couldn't read body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	slog.Info("received HTTP logs", "path", r.URL.Path, "size", len(data))
+	ingest(w, data, db, map[string]any{"peer": r.RemoteAddr})
+}
+
+func writeIngestResponse(w http.ResponseWriter, resp ingestResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Accepted == 0 && len(resp.Errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ingestJSON appends a JSON array of logs, or newline-delimited logs.
+func ingestJSON(w http.ResponseWriter, body []byte, db *DB, fields map[string]any) {
+	resp := ingestResponse{Errors: []ingestError{}}
+	body = bytes.TrimSpace(body)
+
+	if bytes.HasPrefix(body, []byte("[")) {
+		var logs []json.RawMessage
+		err := json.Unmarshal(body, &logs)
+		if err != nil {
+			http.Error(w, "invalid JSON array: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		for i, logJSON := range logs {
+			err := db.appendLogWithFields(logJSON, fields)
+			if err != nil {
+				resp.Errors = append(resp.Errors, ingestError{Index: i, Error: err.Error()})
+				continue
+			}
+			resp.Accepted++
+		}
+		writeIngestResponse(w, resp)
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, maxRequestSize)
+	for i := 0; scanner.Scan(); i++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		err := appendLine(db, scanner.Bytes(), fields)
+		if err != nil {
+			resp.Errors = append(resp.Errors, ingestError{Index: i, Error: err.Error()})
+			continue
+		}
+		resp.Accepted++
+	}
+	writeIngestResponse(w, resp)
+}
+
+type lokiPushRequest struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][]string        `json:"values"`
+	} `json:"streams"`
+}
+
+// ingestLoki appends the entries of a Loki push request. Stream labels are
+// added as fields, and entries that aren't JSON objects become messages.
+func ingestLoki(w http.ResponseWriter, body []byte, db *DB, fields map[string]any) {
+	var req lokiPushRequest
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		http.Error(w, "invalid Loki push request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := ingestResponse{Errors: []ingestError{}}
+	i := 0
+	for _, stream := range req.Streams {
+		for _, value := range stream.Values {
+			err := appendLokiEntry(db, stream.Stream, value, fields)
+			if err != nil {
+				resp.Errors = append(resp.Errors, ingestError{Index: i, Error: err.Error()})
+			} else {
+				resp.Accepted++
+			}
+			i++
+		}
+	}
+
+	if len(resp.Errors) > 0 {
+		writeIngestResponse(w, resp)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func appendLokiEntry(db *DB, labels map[string]string, value []string, fields map[string]any) error {
+	if len(value) < 2 {
+		return fmt.Errorf("invalid Loki entry: expected timestamp and line")
+	}
+
+	entryFields := make(map[string]any, len(labels)+len(fields)+1)
+	for k, v := range fields {
+		entryFields[k] = v
+	}
+	for k, v := range labels {
+		entryFields[k] = v
+	}
+
+	line := []byte(value[1])
+	var logData map[string]any
+	if json.Unmarshal(line, &logData) != nil || logData == nil {
+		logData = map[string]any{"msg": value[1]}
+	}
+	if _, ok := findTimestamp(logData); !ok {
+		entryFields["timestamp"] = value[0]
+	}
+
+	logJSON, err := json.Marshal(logData)
+	if err != nil {
+		return fmt.Errorf("couldn't convert Loki entry: %w", err)
+	}
+	return db.appendLogWithFields(logJSON, entryFields)
+}
+
+type otlpPartialSuccess struct {
+	RejectedLogRecords int64  `json:"rejectedLogRecords,string"`
+	ErrorMessage       string `json:"errorMessage"`
+}
+
+// ingestOTLP appends the log records of an OTLP/HTTP export request, and
+// replies with an export response.
+func ingestOTLP(w http.ResponseWriter, body []byte, db *DB, fields map[string]any) {
+	logs, err := parseOTLP(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := map[string]any{}
+	rejected := otlpPartialSuccess{}
+	for _, logData := range logs {
+		logJSON, err := json.Marshal(logData)
+		if err == nil {
+			err = db.appendLogWithFields(logJSON, fields)
+		}
+		if err != nil {
+			rejected.RejectedLogRecords++
+			rejected.ErrorMessage = err.Error()
+		}
+	}
+	if rejected.RejectedLogRecords > 0 {
+		resp["partialSuccess"] = rejected
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type bulkItem map[string]bulkResult
+
+type bulkResult struct {
+	Status int         `json:"status"`
+	Error  *bulkReason `json:"error,omitempty"`
+}
+
+type bulkReason struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// ingestBulk appends the documents of an Elasticsearch bulk request, and
+// replies with a bulk response so that shippers can retry failed documents.
+func ingestBulk(w http.ResponseWriter, body []byte, db *DB, fields map[string]any) {
+	items := []bulkItem{}
+	hasErrors := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, maxRequestSize)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var action map[string]json.RawMessage
+		err := json.Unmarshal(scanner.Bytes(), &action)
+		if err != nil || len(action) != 1 {
+			http.Error(w, "invalid bulk action: "+scanner.Text(), http.StatusBadRequest)
+			return
+		}
+		var name string
+		for name = range action {
+			break
+		}
+		if name == "delete" {
+			items = append(items, bulkItem{name: {Status: http.StatusNotFound}})
+			continue
+		}
+
+		if !scanner.Scan() {
+			http.Error(w, "missing document for bulk action", http.StatusBadRequest)
+			return
+		}
+		result := bulkResult{Status: http.StatusCreated}
+		if name != "index" && name != "create" {
+			result = bulkResult{
+				Status: http.StatusBadRequest,
+				Error:  &bulkReason{Type: "illegal_argument_exception", Reason: "unsupported action: " + name},
+			}
+		} else if err := db.appendLogWithFields(scanner.Bytes(), fields); err != nil {
+			result = bulkResult{
+				Status: http.StatusBadRequest,
+				Error:  &bulkReason{Type: "mapper_parsing_exception", Reason: err.Error()},
+			}
+		}
+		hasErrors = hasErrors || result.Error != nil
+		items = append(items, bulkItem{name: result})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"took": 0, "errors": hasErrors, "items": items})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPost(t *testing.T, handler http.Handler, path string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHTTPIngestJSON(t *testing.T) {
+	db := testOpenDatabase(t)
+	handler := newHTTPHandler(db)
+
+	rec := testPost(t, handler, "/", `[{"msg":"one"},{"msg":"two"},"three"]`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(
+		t,
+		`{"accepted":2,"errors":[{"index":2,"error":"invalid json data: json: cannot unmarshal string into Go value of type map[string]interface {}"}]}`,
+		rec.Body.String(),
+	)
+
+	rec = testPost(t, handler, "/ingest", "{\"msg\":\"four\"}\n\n{\"msg\":\"five\"}\n{")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var resp ingestResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Accepted)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, 3, resp.Errors[0].Index)
+
+	rec = testPost(t, handler, "/", `[`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = testPost(t, handler, "/", `nope`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	logs := testWaitLogs(t, db, 4)
+	assert.Len(t, logs, 4)
+	assert.Equal(t, "192.0.2.1:1234", logs[0].data["peer"])
+}
+
+func TestHTTPIngestGzip(t *testing.T) {
+	db := testOpenDatabase(t)
+
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(`{"msg":"compressed"}`))
+	gz.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	newHTTPHandler(db).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	logs := testWaitLogs(t, db, 1)
+	assert.Equal(t, "compressed", logs[0].message)
+}
+
+func TestHTTPIngestLoki(t *testing.T) {
+	db := testOpenDatabase(t)
+	ts := time.Date(2023, time.July, 24, 18, 34, 11, 241000000, time.UTC)
+
+	rec := testPost(t, newHTTPHandler(db), "/loki/api/v1/push", `{"streams":[{
+		"stream":{"app":"api","level":"warn"},
+		"values":[
+			["yesterday", "plain line"],
+			["1690223651241000000", "{\"msg\":\"json line\",\"level\":\"error\"}"]
+		]
+	}]}`)
+	// the first timestamp is invalid, which doesn't fail the entry
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	logs := testWaitLogs(t, db, 2)
+	for _, l := range logs {
+		assert.Equal(t, "api", l.data["app"])
+		switch l.message {
+		case "plain line":
+			assert.Equal(t, severityWarn, l.severity)
+		case "json line":
+			assert.Equal(t, severityError, l.severity)
+			assert.Equal(t, ts, l.timestamp.UTC())
+		default:
+			t.Errorf("unexpected log: %v", l)
+		}
+	}
+
+	rec = testPost(t, newHTTPHandler(db), "/loki/api/v1/push", `{"streams":[{"values":[["1"]]}]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "expected timestamp and line")
+
+	req := httptest.NewRequest(http.MethodPost, "/loki/api/v1/push", strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	rec = httptest.NewRecorder()
+	newHTTPHandler(db).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+}
+
+func TestHTTPIngestBulk(t *testing.T) {
+	db := testOpenDatabase(t)
+
+	rec := testPost(t, newHTTPHandler(db), "/logs/_bulk", `{"index":{"_index":"logs"}}
+{"msg":"indexed"}
+{"create":{}}
+{"msg":"created"}
+{"delete":{"_id":"1"}}
+{"update":{"_id":"1"}}
+{"doc":{"msg":"updated"}}
+{"index":{}}
+not json
+`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Errors bool       `json:"errors"`
+		Items  []bulkItem `json:"items"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.True(t, resp.Errors)
+	assert.Len(t, resp.Items, 5)
+	assert.Equal(t, http.StatusCreated, resp.Items[0]["index"].Status)
+	assert.Equal(t, http.StatusCreated, resp.Items[1]["create"].Status)
+	assert.Equal(t, http.StatusBadRequest, resp.Items[3]["update"].Status)
+	assert.Equal(t, http.StatusBadRequest, resp.Items[4]["index"].Status)
+
+	testWaitLogs(t, db, 2)
+
+	rec = testPost(t, newHTTPHandler(db), "/_bulk", `{"index":{}}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHTTPIngestQuotedKeys(t *testing.T) {
+	db := testOpenDatabase(t)
+	handler := newHTTPHandler(db)
+
+	rec := testPost(t, handler, "/", `{"msg":"json","it's \"quoted\"":1}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = testPost(t, handler, "/loki/api/v1/push", `{"streams":[{
+		"stream":{"it's \"quoted\"":"1"},
+		"values":[["1690223651241000000","loki"]]
+	}]}`)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = testPost(t, handler, "/v1/logs", `{"resourceLogs":[{"scopeLogs":[{"logRecords":[{
+		"body":{"stringValue":"otlp"},
+		"attributes":[{"key":"it's \"quoted\"","value":{"intValue":"1"}}]
+	}]}]}]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = testPost(t, handler, "/_bulk", "{\"index\":{}}\n{\"msg\":\"bulk\",\"x')); DROP TABLE logs; --\":1}\n")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), `"errors":true`)
+
+	logs := testWaitLogs(t, db, 4)
+	assert.Len(t, logs, 4)
+}
+
+func TestHTTPMethods(t *testing.T) {
+	handler := newHTTPHandler(nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"version"`)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_bulk", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// appendLine appends a line read from an input, which may be a JSON object,
+// an OTLP/JSON logs export or a syslog message, with additional fields such as
+// its source.
+func appendLine(db *DB, line []byte, fields map[string]any) error {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return nil
+	}
+	if isSyslog(line) {
+		logData, err := parseSyslog(line)
+		if err != nil {
+			return fmt.Errorf("invalid syslog message: %w", err)
+		}
+		line, err = json.Marshal(logData)
+		if err != nil {
+			return fmt.Errorf("couldn't convert syslog message: %w", err)
+		}
+	} else if isOTLP(line) {
+		_, err := appendOTLP(db, line, fields)
+		return err
+	}
+	return db.appendLogWithFields(line, fields)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// journalExportPrefixes are the fields starting journal export streams.
+var journalExportPrefixes = [][]byte{[]byte("__CURSOR="), []byte("__REALTIME_TIMESTAMP=")}
+
+// maxJournalFieldSize is the largest binary field accepted in journal export
+// streams.
+const maxJournalFieldSize = 64 << 20
+
+// isJournalJSON reports whether logData is a journal entry, as written by
+// `journalctl -o json`.
+func isJournalJSON(logData map[string]any) bool {
+	_, ok := logData["__REALTIME_TIMESTAMP"]
+	return ok
+}
+
+// journalFields reads the timestamp from __REALTIME_TIMESTAMP, the level
+// from PRIORITY and the message from MESSAGE. When the message is a JSON
+// object, its own message is used.
+func journalFields(entry map[string]any) schemaFields {
+	var fields schemaFields
+	if usec, err := strconv.ParseInt(fmt.Sprint(entry["__REALTIME_TIMESTAMP"]), 10, 64); err == nil {
+		fields.timestamp = time.UnixMicro(usec).UTC().Format(time.RFC3339Nano)
+	}
+	if priority, ok := entry["PRIORITY"].(string); ok {
+		if n, err := strconv.Atoi(priority); err == nil && n >= 0 && n < len(syslogSeverities) {
+			fields.level = syslogSeverities[n].String()
+		}
+	}
+
+	message, ok := entry["MESSAGE"]
+	if !ok {
+		return fields
+	}
+	msg := journalString(message)
+	fields.message = msg
+	var msgData map[string]any
+	if strings.HasPrefix(msg, "{") && json.Unmarshal([]byte(msg), &msgData) == nil {
+		if inner, ok := messageField(msgData); ok {
+			fields.message = inner
+		}
+	}
+	return fields
+}
+
+// journalString decodes a journal field value. journalctl writes fields that
+// aren't valid UTF-8 as arrays of bytes, and repeated fields as arrays of
+// values, of which the first is used.
+func journalString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []any:
+		if len(v) == 0 {
+			return ""
+		}
+		if _, ok := v[0].(float64); !ok {
+			return journalString(v[0])
+		}
+		b := make([]byte, 0, len(v))
+		for _, c := range v {
+			n, _ := c.(float64)
+			b = append(b, byte(n))
+		}
+		return strings.ToValidUTF8(string(b), "�")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// isJournalExport reports whether data starts a journal export stream, as
+// written by `journalctl -o export`.
+func isJournalExport(data []byte) bool {
+	for _, prefix := range journalExportPrefixes {
+		if bytes.HasPrefix(data, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanJournalExport appends the entries of a journal export stream. Entries
+// are separated by empty lines, and fields are either "KEY=value" lines, or
+// binary-safe: the key on its own line, followed by the size of the value as a
+// 64-bit little-endian integer, the value and a newline.
+func scanJournalExport(r io.Reader, source string, db *DB) error {
+	var fields map[string]any
+	if source != "" {
+		fields = map[string]any{"source": source}
+	}
+	slog.Info("reading journal export stream", "source", source)
+
+	br := bufio.NewReader(r)
+	entry := map[string]any{}
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("couldn't read journal export: %w", err)
+		}
+		eof := errors.Is(err, io.EOF)
+		line = bytes.TrimSuffix(line, []byte("\n"))
+
+		if len(line) == 0 {
+			if len(entry) > 0 {
+				err := appendJournalEntry(db, entry, fields)
+				if err != nil {
+					return err
+				}
+				entry = map[string]any{}
+			}
+			if eof {
+				return nil
+			}
+			continue
+		}
+
+		if key, value, ok := bytes.Cut(line, []byte("=")); ok {
+			entry[string(key)] = string(value)
+		} else if !eof {
+			var size uint64
+			err := binary.Read(br, binary.LittleEndian, &size)
+			if err != nil {
+				return fmt.Errorf("invalid binary field %s: %w", line, err)
+			}
+			if size > maxJournalFieldSize {
+				return fmt.Errorf("binary field %s too large: %d bytes", line, size)
+			}
+			value := make([]byte, size+1)
+			_, err = io.ReadFull(br, value)
+			if err != nil {
+				return fmt.Errorf("invalid binary field %s: %w", line, err)
+			}
+			entry[string(line)] = strings.ToValidUTF8(string(value[:size]), "�")
+		}
+
+		if eof {
+			if len(entry) > 0 {
+				return appendJournalEntry(db, entry, fields)
+			}
+			return nil
+		}
+	}
+}
+
+func appendJournalEntry(db *DB, entry map[string]any, fields map[string]any) error {
+	logJSON, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("couldn't convert journal entry: %w", err)
+	}
+	return db.appendLogWithFields(logJSON, fields)
+}
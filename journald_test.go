@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalFields(t *testing.T) {
+	type testCase struct {
+		name   string
+		in     map[string]any
+		expect schemaFields
+	}
+	testCases := []testCase{
+		{
+			name: "text message",
+			in: map[string]any{
+				"__REALTIME_TIMESTAMP": "1697062455003000",
+				"PRIORITY":             "3",
+				"MESSAGE":              "failed to start",
+				"_SYSTEMD_UNIT":        "nginx.service",
+			},
+			expect: schemaFields{
+				timestamp: "2023-10-11T22:14:15.003Z",
+				level:     "error",
+				message:   "failed to start",
+			},
+		},
+		{
+			name: "byte array message",
+			in: map[string]any{
+				"__REALTIME_TIMESTAMP": "1697062455000000",
+				"MESSAGE":              []any{float64('h'), float64('i'), float64(0xff)},
+			},
+			expect: schemaFields{timestamp: "2023-10-11T22:14:15Z", message: "hi�"},
+		},
+		{
+			name: "no message",
+			in: map[string]any{
+				"__REALTIME_TIMESTAMP": "1697062455000000",
+				"_SYSTEMD_UNIT":        "nginx.service",
+			},
+			expect: schemaFields{timestamp: "2023-10-11T22:14:15Z"},
+		},
+		{
+			name: "JSON message",
+			in: map[string]any{
+				"__REALTIME_TIMESTAMP": "1697062455000000",
+				"PRIORITY":             "6",
+				"MESSAGE":              `{"msg":"request","status":200}`,
+			},
+			expect: schemaFields{timestamp: "2023-10-11T22:14:15Z", level: "info", message: "request"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expect, journalFields(c.in))
+		})
+	}
+}
+
+func TestJournalString(t *testing.T) {
+	assert.Equal(t, "hello", journalString("hello"))
+	assert.Equal(t, "ok", journalString([]any{float64('o'), float64('k')}))
+	assert.Equal(t, "first", journalString([]any{"first", "second"}))
+	assert.Equal(t, "", journalString(nil))
+}
+
+func TestScanJournalExport(t *testing.T) {
+	buf := bytes.Buffer{}
+	buf.WriteString("__CURSOR=s=1\n__REALTIME_TIMESTAMP=1697062455000000\nPRIORITY=4\n_SYSTEMD_UNIT=app.service\nMESSAGE=disk almost full\n\n")
+	buf.WriteString("__CURSOR=s=2\n__REALTIME_TIMESTAMP=1697062456000000\nPRIORITY=6\nMESSAGE\n")
+	message := "line one\nline two"
+	binary.Write(&buf, binary.LittleEndian, uint64(len(message)))
+	buf.WriteString(message + "\n\n")
+
+	assert.True(t, isJournalExport(buf.Bytes()))
+	assert.False(t, isJournalExport([]byte(`{"__CURSOR":"s=1"}`)))
+
+	db := testOpenDatabase(t)
+	assert.NoError(t, scanArchive(&buf, "", db))
+
+	logs := testWaitLogs(t, db, 2)
+	assert.Len(t, logs, 2)
+	assert.Equal(t, "line one\nline two", logs[0].message)
+	assert.Equal(t, "info", logs[0].level)
+	assert.Equal(t, "disk almost full", logs[1].message)
+	assert.Equal(t, "warn", logs[1].level)
+	assert.Equal(t, "app.service", logs[1].data["_SYSTEMD_UNIT"])
+	assert.Equal(t, time.UnixMicro(1697062455000000).UTC(), logs[1].timestamp.UTC())
+}
+
+func TestScanJournalExportTruncated(t *testing.T) {
+	db := testOpenDatabase(t)
+	in := "__CURSOR=s=1\nMESSAGE\n\x10\x00"
+	assert.Error(t, scanArchive(bytes.NewReader([]byte(in)), "", db))
+}
+
+func TestAppendLineJournalJSON(t *testing.T) {
+	db := testOpenDatabase(t)
+	line := `{"__REALTIME_TIMESTAMP":"1697062455000000","PRIORITY":"2","MESSAGE":"kernel panic","_SYSTEMD_UNIT":"kernel"}`
+	assert.NoError(t, appendLine(db, []byte(line), nil))
+
+	logs := testWaitLogs(t, db, 1)
+	assert.Equal(t, "kernel panic", logs[0].message)
+	assert.Equal(t, "critical", logs[0].level)
+	assert.Equal(t, severityCritical, logs[0].severity)
+	// the entry is stored as sent
+	assert.Equal(t, map[string]any{
+		"__REALTIME_TIMESTAMP": "1697062455000000",
+		"PRIORITY":             "2",
+		"MESSAGE":              "kernel panic",
+		"_SYSTEMD_UNIT":        "kernel",
+	}, logs[0].data)
+}
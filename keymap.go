@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// keyAction describes a user action that can be bound to keys.
+type keyAction struct {
+	name        string
+	description string
+	// label is the short name shown in the footer next to function keys.
+	label       string
+	defaultKeys []string
+}
+
+// keyActions lists every bindable action, in the order they are shown in the
+// help page and the footer.
+var keyActions = []keyAction{
+	{name: "help", description: "show this help", label: "Help", defaultKeys: []string{"?", "F1"}},
+	{name: "patterns", description: "list message templates", label: "Patterns", defaultKeys: []string{"P", "F2"}},
+	{name: "anomalies", description: "list rate spikes", label: "Spikes", defaultKeys: []string{"A", "F3"}},
+	{name: "alerts", description: "list fired alerts", label: "Alerts", defaultKeys: []string{"!", "F4"}},
+	{name: "down", description: "select next log", defaultKeys: []string{"j", "Down"}},
+	{name: "up", description: "select previous log", defaultKeys: []string{"k", "Up"}},
+	{name: "page-down", description: "move down half a page", defaultKeys: []string{"Ctrl-D", "PgDn"}},
+	{name: "page-up", description: "move up half a page", defaultKeys: []string{"Ctrl-U", "PgUp"}},
+	{name: "top", description: "select newest log", defaultKeys: []string{"g", "Home"}},
+	{name: "bottom", description: "select oldest log", defaultKeys: []string{"G", "End"}},
+	{
+		name:        "time-mode",
+		description: "cycle time display: local, UTC, zone, relative",
+		label:       "Time",
+		defaultKeys: []string{"t", "F5"},
+	},
+	{name: "toggle-delta", description: "toggle delta column", label: "Delta", defaultKeys: []string{"d", "F6"}},
+	{name: "trace", description: "show the logs of the selected trace, or all logs", defaultKeys: []string{"T"}},
+	{name: "mark", description: "mark or unmark the selected log", defaultKeys: []string{"m"}},
+	{name: "note", description: "write a note on the selected log, marking it", defaultKeys: []string{"n"}},
+	{name: "next-mark", description: "select next marked log", defaultKeys: []string{"]"}},
+	{name: "prev-mark", description: "select previous marked log", defaultKeys: []string{"["}},
+	{name: "bookmarks", description: "list marked logs", defaultKeys: []string{"b"}},
+	{name: "export-bookmarks", description: "export marked logs as JSON lines", defaultKeys: []string{"E"}},
+	{name: "yank-message", description: "copy the message of the selected log", defaultKeys: []string{"y"}},
+	{name: "yank-json", description: "copy the JSON of the selected log", defaultKeys: []string{"Y"}},
+	{name: "yank-field", description: "copy a field of the selected log", defaultKeys: []string{"v"}},
+	{name: "yank-logs", description: "copy the marked or selected logs as JSON lines", defaultKeys: []string{"Ctrl-Y"}},
+	{name: "open", description: "open the selected log in $PAGER or $EDITOR", defaultKeys: []string{"o"}},
+	{name: "open-all", description: "open the logs shown in $PAGER or $EDITOR", defaultKeys: []string{"O"}},
+	{name: "pipe", description: "pipe the selected log to a command", defaultKeys: []string{"|"}},
+	{name: "pipe-all", description: "pipe the logs shown to a command", defaultKeys: []string{"\\"}},
+	{name: "context", description: "show the logs around the selected log", defaultKeys: []string{"c"}},
+	{name: "more-context", description: "show more logs in the context page", defaultKeys: []string{">"}},
+	{name: "less-context", description: "show fewer logs in the context page", defaultKeys: []string{"<"}},
+	{name: "fields", description: "list fields with statistics, to sort by a field", defaultKeys: []string{"f"}},
+	{name: "chart", description: "chart the distribution and percentiles of a numeric field", defaultKeys: []string{"h"}},
+	{name: "clear-filter", description: "show all logs, clearing filters, time range and sort", defaultKeys: []string{"Esc"}},
+	{name: "pause", description: "pause or resume the replay", label: "Pause", defaultKeys: []string{"p", "F7"}},
+	{name: "step", description: "replay the next log while paused", defaultKeys: []string{"."}},
+	{name: "faster", description: "double the replay speed", defaultKeys: []string{"+"}},
+	{name: "slower", description: "halve the replay speed", defaultKeys: []string{"-"}},
+	{name: "restart", description: "restart the monitored command", label: "Restart", defaultKeys: []string{"R", "F8"}},
+	{name: "kill", description: "terminate the monitored command", label: "Kill", defaultKeys: []string{"K", "F9"}},
+	{name: "quit", description: "quit ltop", label: "Quit", defaultKeys: []string{"q", "F10"}},
+}
+
+// keyBinding identifies a key press. ch is only set for tcell.KeyRune.
+type keyBinding struct {
+	key tcell.Key
+	ch  rune
+}
+
+// keymap binds key presses to action names.
+type keymap struct {
+	bindings map[keyBinding]string
+	// keys holds the key names bound to each action, for display.
+	keys map[string][]string
+}
+
+var keysByName = func() map[string]tcell.Key {
+	keys := make(map[string]tcell.Key, len(tcell.KeyNames))
+	for k, name := range tcell.KeyNames {
+		keys[strings.ToLower(name)] = k
+	}
+	return keys
+}()
+
+// newKeymap creates a keymap from the default bindings. Actions present in
+// overrides are bound to the given keys instead of their defaults. A key
+// can't be bound to two actions.
+func newKeymap(overrides map[string][]string) (*keymap, error) {
+	km := keymap{bindings: map[keyBinding]string{}, keys: map[string][]string{}}
+	known := map[string]bool{}
+	for _, a := range keyActions {
+		known[a.name] = true
+	}
+	for name := range overrides {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown key action: \"%s\"", name)
+		}
+	}
+
+	for _, a := range keyActions {
+		keys, ok := overrides[a.name]
+		if !ok {
+			keys = a.defaultKeys
+		}
+		for _, k := range keys {
+			b, err := parseKey(k)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key for \"%s\": %w", a.name, err)
+			}
+			if other, ok := km.bindings[b]; ok && other != a.name {
+				return nil, fmt.Errorf("key \"%s\" is bound to both \"%s\" and \"%s\"", k, other, a.name)
+			}
+			km.bindings[b] = a.name
+		}
+		km.keys[a.name] = keys
+	}
+	return &km, nil
+}
+
+// parseKey parses a key name, either a single character or one of the names
+// in tcell.KeyNames, such as "F1", "Ctrl-D" or "PgDn". Names are case
+// insensitive.
+func parseKey(s string) (keyBinding, error) {
+	if r := []rune(s); len(r) == 1 {
+		return keyBinding{key: tcell.KeyRune, ch: r[0]}, nil
+	}
+	if k, ok := keysByName[strings.ToLower(s)]; ok {
+		return keyBinding{key: k}, nil
+	}
+	return keyBinding{}, fmt.Errorf("unknown key: \"%s\"", s)
+}
+
+// lookup returns the action bound to the key event, if any.
+func (km *keymap) lookup(e *tcell.EventKey) (string, bool) {
+	b := keyBinding{key: e.Key()}
+	if b.key == tcell.KeyRune {
+		b.ch = e.Rune()
+	}
+	name, ok := km.bindings[b]
+	return name, ok
+}
+
+// helpText lists every action with its keys, for the help page.
+func (km *keymap) helpText(th *theme) string {
+	builder := strings.Builder{}
+	for _, a := range keyActions {
+		fmt.Fprintf(
+			&builder,
+			"%s%-20s[-:-:-] %s\n",
+			th.keyTag,
+			tview.Escape(strings.Join(km.keys[a.name], ", ")),
+			a.description,
+		)
+	}
+	return builder.String()
+}
+
+// footerText lists the actions bound to function keys, htop-style.
+func (km *keymap) footerText(th *theme) string {
+	builder := strings.Builder{}
+	for _, a := range keyActions {
+		if a.label == "" {
+			continue
+		}
+		for _, k := range km.keys[a.name] {
+			b, _ := parseKey(k)
+			if b.key >= tcell.KeyF1 && b.key <= tcell.KeyF64 {
+				fmt.Fprintf(&builder, "%s%s%-6s[-:-:-] ", k, th.labelTag, a.label)
+				break
+			}
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKey(t *testing.T) {
+	type testCase struct {
+		in     string
+		expect keyBinding
+		err    bool
+	}
+	testCases := []testCase{
+		{in: "q", expect: keyBinding{key: tcell.KeyRune, ch: 'q'}},
+		{in: "?", expect: keyBinding{key: tcell.KeyRune, ch: '?'}},
+		{in: "F1", expect: keyBinding{key: tcell.KeyF1}},
+		{in: "ctrl-d", expect: keyBinding{key: tcell.KeyCtrlD}},
+		{in: "PgDn", expect: keyBinding{key: tcell.KeyPgDn}},
+		{in: "Esc", expect: keyBinding{key: tcell.KeyEscape}},
+		{in: "", err: true},
+		{in: "Hyper-X", err: true},
+	}
+	for _, c := range testCases {
+		t.Run(c.in, func(t *testing.T) {
+			got, err := parseKey(c.in)
+			if c.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expect, got)
+		})
+	}
+}
+
+func TestKeymapLookup(t *testing.T) {
+	km, err := newKeymap(map[string][]string{"quit": {"x", "F12"}})
+	assert.NoError(t, err)
+
+	action, ok := km.lookup(tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModNone))
+	assert.True(t, ok)
+	assert.Equal(t, "quit", action)
+
+	_, ok = km.lookup(tcell.NewEventKey(tcell.KeyRune, 'q', tcell.ModNone))
+	assert.False(t, ok)
+
+	action, ok = km.lookup(tcell.NewEventKey(tcell.KeyCtrlD, 0, tcell.ModCtrl))
+	assert.True(t, ok)
+	assert.Equal(t, "page-down", action)
+
+	action, ok = km.lookup(tcell.NewEventKey(tcell.KeyRune, 'G', tcell.ModNone))
+	assert.True(t, ok)
+	assert.Equal(t, "bottom", action)
+
+	assert.Contains(t, km.footerText(themes["dark"]), "F12")
+	assert.Contains(t, km.helpText(themes["dark"]), "x, F12")
+}
+
+func TestNewKeymapErrors(t *testing.T) {
+	_, err := newKeymap(map[string][]string{"explode": {"x"}})
+	assert.Error(t, err)
+
+	_, err = newKeymap(map[string][]string{"quit": {"Hyper-X"}})
+	assert.Error(t, err)
+
+	_, err = newKeymap(map[string][]string{"quit": {"j"}})
+	assert.ErrorContains(t, err, `"down"`)
+	assert.ErrorContains(t, err, `"quit"`)
+
+	// swapping keys is allowed
+	_, err = newKeymap(map[string][]string{"quit": {"K"}, "kill": {"q"}})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// severity is an ordered rank for log levels. Higher values are more severe,
+// and severityNone is used for logs with a missing or unrecognized level.
+type severity int
+
+const (
+	severityNone severity = iota
+	severityTrace
+	severityDebug
+	severityInfo
+	severityNotice
+	severityWarn
+	severityError
+	severityCritical
+	severityAlert
+	severityFatal
+	severityPanic
+	severityEmergency
+)
+
+var severityNames = map[severity]string{
+	severityTrace:     "trace",
+	severityDebug:     "debug",
+	severityInfo:      "info",
+	severityNotice:    "notice",
+	severityWarn:      "warn",
+	severityError:     "error",
+	severityCritical:  "critical",
+	severityAlert:     "alert",
+	severityFatal:     "fatal",
+	severityPanic:     "panic",
+	severityEmergency: "emergency",
+}
+
+func (s severity) String() string {
+	return severityNames[s]
+}
+
+// levelKeys are the JSON keys looked up, in order, for the log level.
+var levelKeys = []string{"level", "lvl", "L", "severity", "levelname"}
+
+var levelAliases = map[string]severity{
+	"trace":         severityTrace,
+	"trac":          severityTrace,
+	"trc":           severityTrace,
+	"debug":         severityDebug,
+	"debu":          severityDebug,
+	"dbg":           severityDebug,
+	"info":          severityInfo,
+	"inf":           severityInfo,
+	"information":   severityInfo,
+	"informational": severityInfo,
+	"notice":        severityNotice,
+	"warning":       severityWarn,
+	"warn":          severityWarn,
+	"wrn":           severityWarn,
+	"error":         severityError,
+	"erro":          severityError,
+	"err":           severityError,
+	"critical":      severityCritical,
+	"crit":          severityCritical,
+	"alert":         severityAlert,
+	"fatal":         severityFatal,
+	"fata":          severityFatal,
+	"ftl":           severityFatal,
+	"dpanic":        severityPanic,
+	"panic":         severityPanic,
+	"emergency":     severityEmergency,
+	"emerg":         severityEmergency,
+}
+
+// syslogSeverities maps RFC5424 severity codes (0-7) to severities.
+var syslogSeverities = []severity{
+	severityEmergency,
+	severityAlert,
+	severityCritical,
+	severityError,
+	severityWarn,
+	severityNotice,
+	severityInfo,
+	severityDebug,
+}
+
+// pinoSeverities maps Pino/Bunyan numeric levels to severities.
+var pinoSeverities = map[int]severity{
+	10: severityTrace,
+	20: severityDebug,
+	30: severityInfo,
+	40: severityWarn,
+	50: severityError,
+	60: severityFatal,
+}
+
+// parseLevel normalizes a level value decoded from JSON. It returns the level
+// name to display and its severity. Unrecognized levels are returned as is,
+// with severityNone.
+func parseLevel(l any) (string, severity) {
+	switch l := l.(type) {
+	case string:
+		if s, ok := levelAliases[strings.ToLower(l)]; ok {
+			return s.String(), s
+		}
+		if n, err := strconv.Atoi(l); err == nil {
+			if s := numericSeverity(n); s != severityNone {
+				return s.String(), s
+			}
+		}
+		return l, severityNone
+	case float64:
+		if l == math.Trunc(l) {
+			if s := numericSeverity(int(l)); s != severityNone {
+				return s.String(), s
+			}
+		}
+		return strconv.FormatFloat(l, 'f', -1, 64), severityNone
+	case int:
+		if s := numericSeverity(l); s != severityNone {
+			return s.String(), s
+		}
+		return strconv.Itoa(l), severityNone
+	default:
+		return "", severityNone
+	}
+}
+
+// numericSeverity maps syslog (0-7) and Pino/Bunyan (10-60) numeric levels.
+func numericSeverity(n int) severity {
+	if n >= 0 && n < len(syslogSeverities) {
+		return syslogSeverities[n]
+	}
+	return pinoSeverities[n]
+}
+
+// findLevel returns the normalized level from the level field of the schema
+// of logData, or from the first level key present in it.
+func findLevel(logData map[string]any) (string, severity) {
+	if l := findSchemaFields(logData).level; l != nil {
+		return parseLevel(l)
+	}
+	for _, key := range levelKeys {
+		if l, ok := logData[key]; ok && l != nil {
+			return parseLevel(l)
+		}
+	}
+	return "", severityNone
+}
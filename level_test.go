@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLevel(t *testing.T) {
+	type testCase struct {
+		in       any
+		level    string
+		severity severity
+	}
+	testCases := []testCase{
+		{in: "info", level: "info", severity: severityInfo},
+		{in: "INFO", level: "info", severity: severityInfo},
+		{in: "WARNING", level: "warn", severity: severityWarn},
+		{in: "erro", level: "error", severity: severityError},
+		{in: "DPANIC", level: "panic", severity: severityPanic},
+		{in: "crit", level: "critical", severity: severityCritical},
+		{in: "emerg", level: "emergency", severity: severityEmergency},
+		{in: "trace", level: "trace", severity: severityTrace},
+		{in: "verbose", level: "verbose", severity: severityNone},
+		{in: float64(30), level: "info", severity: severityInfo},
+		{in: float64(60), level: "fatal", severity: severityFatal},
+		{in: float64(0), level: "emergency", severity: severityEmergency},
+		{in: float64(3), level: "error", severity: severityError},
+		{in: float64(7), level: "debug", severity: severityDebug},
+		{in: float64(35), level: "35", severity: severityNone},
+		{in: float64(1.5), level: "1.5", severity: severityNone},
+		{in: "4", level: "warn", severity: severityWarn},
+		{in: true, level: "", severity: severityNone},
+	}
+	for _, c := range testCases {
+		t.Run(fmt.Sprintf("%T(%v)", c.in, c.in), func(t *testing.T) {
+			level, sev := parseLevel(c.in)
+			assert.Equal(t, c.level, level)
+			assert.Equal(t, c.severity, sev)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// maxDatagramSize is the largest UDP payload.
+const maxDatagramSize = 65535
+
+// listen starts accepting logs at address, a URL such as tcp://:5140 or
+// udp://:514. Each line, datagram or syslog frame is appended to the
+// database, with the address of the sender in the "peer" field.
+func listen(address string, db *DB) (net.Addr, io.Closer, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid listen address: %w", err)
+	}
+
+	switch u.Scheme {
+	case "tcp", "tcp4", "tcp6":
+		l, err := net.Listen(u.Scheme, u.Host)
+		if err != nil {
+			return nil, nil, fmt.Errorf("couldn't listen on %s: %w", address, err)
+		}
+		slog.Info("listening for logs", "address", l.Addr())
+		go serveTCP(l, db)
+		return l.Addr(), l, nil
+	case "udp", "udp4", "udp6":
+		conn, err := net.ListenPacket(u.Scheme, u.Host)
+		if err != nil {
+			return nil, nil, fmt.Errorf("couldn't listen on %s: %w", address, err)
+		}
+		slog.Info("listening for logs", "address", conn.LocalAddr())
+		go serveUDP(conn, db)
+		return conn.LocalAddr(), conn, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported listen protocol: \"%s\"", u.Scheme)
+	}
+}
+
+func serveTCP(l net.Listener, db *DB) {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			slog.Error("couldn't accept connection", "error", err)
+			continue
+		}
+		go serveConn(conn, db)
+	}
+}
+
+func serveConn(conn net.Conn, db *DB) {
+	defer conn.Close()
+	peer := conn.RemoteAddr().String()
+	slog.Info("accepted connection", "peer", peer)
+
+	decoder := newEnvelopeDecoder()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, bufio.MaxScanTokenSize*16)
+	scanner.Split(splitFrames)
+	for scanner.Scan() {
+		err := decoder.appendLine(db, scanner.Bytes(), map[string]any{"peer": peer})
+		if err != nil {
+			slog.Warn("couldn't append log", "peer", peer, "error", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		slog.Warn("connection error", "peer", peer, "error", err)
+	}
+	slog.Info("connection closed", "peer", peer)
+}
+
+// serveUDP appends the lines of each datagram. GELF messages may be
+// compressed and chunked.
+func serveUDP(conn net.PacketConn, db *DB) {
+	buf := make([]byte, maxDatagramSize)
+	gelf := newGELFAssembler()
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			slog.Error("couldn't read datagram", "error", err)
+			continue
+		}
+		peer := addr.String()
+
+		data := buf[:n]
+		if isGELFChunk(data) {
+			var complete bool
+			data, complete, err = gelf.add(data, time.Now())
+			if err != nil {
+				slog.Warn("couldn't reassemble GELF message", "peer", peer, "error", err)
+				continue
+			}
+			if !complete {
+				continue
+			}
+		}
+		data, err = decompressGELF(data)
+		if err != nil {
+			slog.Warn("couldn't append log", "peer", peer, "error", err)
+			continue
+		}
+
+		for _, line := range bytes.Split(data, []byte{'\n'}) {
+			err := appendLine(db, line, map[string]any{"peer": peer})
+			if err != nil {
+				slog.Warn("couldn't append log", "peer", peer, "error", err)
+			}
+		}
+	}
+}
+
+// splitFrames is a bufio.SplitFunc for newline-delimited messages, that also
+// handles syslog octet-counted framing (RFC6587), e.g. "11 <14>1 - - -".
+func splitFrames(data []byte, atEOF bool) (int, []byte, error) {
+	space := bytes.IndexByte(data, ' ')
+	if space > 0 && space < 10 && len(data) > space+1 && data[space+1] == '<' {
+		if length, err := strconv.Atoi(string(data[:space])); err == nil && length > 0 {
+			end := space + 1 + length
+			if end <= len(data) {
+				return end, data[space+1 : end], nil
+			}
+			if !atEOF {
+				return 0, nil, nil
+			}
+		}
+	}
+	return bufio.ScanLines(data, atEOF)
+}
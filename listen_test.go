@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenTCP(t *testing.T) {
+	db := testOpenDatabase(t)
+
+	addr, closer, err := listen("tcp://127.0.0.1:0", db)
+	if err != nil {
+		t.Fatalf("unexpected error listening: %s", err)
+	}
+	defer closer.Close()
+
+	peers := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			t.Fatalf("unexpected error connecting: %s", err)
+		}
+		peers[conn.LocalAddr().String()] = true
+		_, err = conn.Write([]byte(`{"level":"info","msg":"from json"}` + "\n" +
+			"<11>Oct 11 22:14:15 host app: from syslog\n" +
+			"24 <14>1 - - - - - - framed"))
+		assert.NoError(t, err)
+		conn.Close()
+	}
+
+	logs := testWaitLogs(t, db, 6)
+	messages := map[string]int{}
+	for _, l := range logs {
+		messages[l.message]++
+		assert.True(t, peers[l.data["peer"].(string)])
+	}
+	assert.Equal(t, map[string]int{"from json": 2, "from syslog": 2, "framed": 2}, messages)
+}
+
+func TestListenUDP(t *testing.T) {
+	db := testOpenDatabase(t)
+
+	addr, closer, err := listen("udp://127.0.0.1:0", db)
+	if err != nil {
+		t.Fatalf("unexpected error listening: %s", err)
+	}
+	defer closer.Close()
+
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatalf("unexpected error connecting: %s", err)
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(`{"level":"warn","msg":"one","peer":"kept"}` + "\n" + `{"msg":"two"}`))
+	assert.NoError(t, err)
+
+	logs := testWaitLogs(t, db, 2)
+	for _, l := range logs {
+		switch l.message {
+		case "one":
+			assert.Equal(t, "kept", l.data["peer"])
+			assert.Equal(t, severityWarn, l.severity)
+		case "two":
+			assert.Equal(t, conn.LocalAddr().String(), l.data["peer"])
+		default:
+			t.Errorf("unexpected log: %v", l)
+		}
+	}
+}
+
+func TestListenInvalidAddress(t *testing.T) {
+	_, _, err := listen("http://:8080", nil)
+	assert.Error(t, err)
+	_, _, err = listen("tcp://256.0.0.1:0", nil)
+	assert.Error(t, err)
+}
+
+func TestSplitFrames(t *testing.T) {
+	scanner := bufio.NewScanner(strings.NewReader(
+		"{\"a\":1}\n11 <14>1 - - -15 <14>1 - - - - -\n12 not framed\r\n",
+	))
+	scanner.Split(splitFrames)
+	frames := []string{}
+	for scanner.Scan() {
+		frames = append(frames, scanner.Text())
+	}
+	assert.NoError(t, scanner.Err())
+	assert.Equal(
+		t,
+		[]string{`{"a":1}`, "<14>1 - - -", "<14>1 - - - - -", "", "12 not framed"},
+		frames,
+	)
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"database/sql"
 	"io"
@@ -29,6 +28,52 @@ func (h *nullHandler) WithGroup(name string) slog.Handler {
 
 func main() {
 	debugLog := pflag.Bool("debug-log", false, "output debug logs to file")
+	timeFormat := pflag.String(
+		"time-format",
+		"",
+		"go time layout string or constant name from time package, tried first when parsing timestamps",
+	)
+	timeZone := pflag.String(
+		"time-zone",
+		"",
+		"time zone used to display timestamps: Local, UTC or an IANA zone name",
+	)
+	timeDisplayFormat := pflag.String(
+		"time-display-format",
+		"",
+		"go time layout string or constant name from time package used to display timestamps",
+	)
+	configPath := pflag.String(
+		"config",
+		"",
+		"path to the JSON config file (default "+defaultConfigPath()+")",
+	)
+	listenAddrs := pflag.StringArray(
+		"listen",
+		nil,
+		"accept JSON lines and syslog messages at a tcp:// or udp:// address, e.g. tcp://:5140 (repeatable)",
+	)
+	httpAddr := pflag.String(
+		"http",
+		"",
+		"accept logs POSTed as JSON, NDJSON, Loki push or Elasticsearch bulk requests at an address, e.g. :9880",
+	)
+	otlpAddr := pflag.String(
+		"otlp",
+		"",
+		"accept OTLP/HTTP logs in JSON at an address",
+	)
+	pflag.Lookup("otlp").NoOptDefVal = defaultOTLPAddress
+	replay := pflag.Bool(
+		"replay",
+		false,
+		"ingest the input file at the pace of its timestamps",
+	)
+	replaySpeed := pflag.String(
+		"speed",
+		"1x",
+		"replay speed, e.g. 10x or 0.5x",
+	)
 	pflag.Parse()
 
 	if *debugLog {
@@ -52,10 +97,64 @@ func main() {
 		slog.SetDefault(slog.New(&nullHandler{}))
 	}
 
-	var err error
+	mustExist := *configPath != ""
+	if !mustExist {
+		*configPath = defaultConfigPath()
+	}
+	cfg, err := loadConfig(*configPath, mustExist)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	km, err := newKeymap(cfg.Keys)
+	if err != nil {
+		panic(err.Error())
+	}
+	th, err := selectTheme(cfg.Theme)
+	if err != nil {
+		panic(err.Error())
+	}
+	rules, err := newHighlightRules(cfg.Rules, th)
+	if err != nil {
+		panic(err.Error())
+	}
+	derived, err := newDerivedFields(cfg.Fields)
+	if err != nil {
+		panic(err.Error())
+	}
+	var alerts *alerter
+	if len(cfg.Alerts) > 0 {
+		alerts, err = newAlerter(cfg.Alerts)
+		if err != nil {
+			panic(err.Error())
+		}
+	}
+
+	// arguments after "--" are a command to run and monitor
+	args := pflag.Args()
+	var command []string
+	if dash := pflag.CommandLine.ArgsLenAtDash(); dash >= 0 {
+		args, command = args[:dash], args[dash:]
+	}
+
+	liveInput := len(command) > 0 || len(*listenAddrs) > 0 || *httpAddr != "" || *otlpAddr != ""
+	var rp *replayer
+	if *replay {
+		if liveInput {
+			panic("--replay only applies to a file or standard input")
+		}
+		speed, err := parseSpeed(*replaySpeed)
+		if err != nil {
+			panic(err.Error())
+		}
+		rp = newReplayer(speed)
+	}
+
 	var input *os.File
-	if pflag.NArg() > 0 {
-		filename := pflag.Arg(0)
+	if len(args) == 0 && liveInput {
+		slog.Info("not reading standard input")
+	} else if len(args) > 0 {
+		filename := args[0]
 		slog.Info("opening file", "filename", filename)
 		input, err = os.Open(filename)
 		if err != nil {
@@ -76,28 +175,100 @@ func main() {
 	if err != nil {
 		panic(err.Error())
 	}
+	if layout, ok := timeLayoutNames[*timeFormat]; ok {
+		db.timeFormat = layout
+	} else {
+		db.timeFormat = *timeFormat
+	}
+	db.replay = rp
+	db.alerts = alerts
+	db.derived = derived
 
-	go scanInput(input, db)
+	if layout, ok := timeLayoutNames[*timeDisplayFormat]; ok {
+		*timeDisplayFormat = layout
+	}
+	td, err := newTimeDisplay(*timeZone, *timeDisplayFormat)
+	if err != nil {
+		panic(err.Error())
+	}
 
-	slog.Info("running application")
-	if err := newApplication(db).Run(); err != nil {
-		panic(err)
+	for _, address := range *listenAddrs {
+		_, _, err := listen(address, db)
+		if err != nil {
+			panic(err.Error())
+		}
 	}
-}
 
-func scanInput(input io.Reader, db *DB) {
-	scanner := bufio.NewScanner(input)
+	for _, address := range []string{*httpAddr, *otlpAddr} {
+		if address == "" {
+			continue
+		}
+		_, _, err := serveHTTP(address, db)
+		if err != nil {
+			panic(err.Error())
+		}
+	}
 
-	for scanner.Scan() {
-		slog.Info("read line from input", "length", len(scanner.Bytes()))
-		err := db.appendLog(scanner.Bytes())
+	var child *childProcess
+	if len(command) > 0 {
+		child = newChildProcess(command, db)
+		err := child.start()
 		if err != nil {
 			panic(err.Error())
 		}
 	}
 
-	err := scanner.Err()
+	var inputDone chan struct{}
+	if input != nil {
+		inputDone = make(chan struct{})
+		go func() {
+			scanInput(input, db)
+			close(inputDone)
+		}()
+	}
+
+	slog.Info("running application")
+	err = newApplication(
+		db,
+		appOptions{
+			timeDisplay: td,
+			keymap:      km,
+			theme:       th,
+			rules:       rules,
+			child:       child,
+			replay:      rp,
+			alerts:      alerts,
+			inputDone:   inputDone,
+		},
+	).Run()
+	if child != nil {
+		child.kill()
+	}
 	if err != nil {
-		panic(err.Error())
+		panic(err)
+	}
+}
+
+// scanInput appends the logs read from input. Input other than a regular
+// file, such as a pipe, is scanned as a live stream.
+func scanInput(input io.Reader, db *DB) {
+	var err error
+	if isRegularFile(input) {
+		err = scanArchive(input, "", db)
+	} else {
+		err = scanStream(input, db)
+	}
+	if err != nil {
+		slog.Error("couldn't read input", "error", err)
+	}
+}
+
+// isRegularFile reports whether r is an open regular file.
+func isRegularFile(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
 	}
+	info, err := f.Stat()
+	return err == nil && info.Mode().IsRegular()
 }
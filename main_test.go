@@ -30,3 +30,36 @@ func TestRace(t *testing.T) {
 	db.queryLogs(time.Time{}, time.Now().UTC())
 	go db.queryLogs(time.Time{}, time.Now().UTC())
 }
+
+// testOpenDatabase creates a database backed by an in-memory SQLite database.
+func testOpenDatabase(t *testing.T) *DB {
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error creating SQL database: %s", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := newDatabase(sqlDB)
+	if err != nil {
+		t.Fatalf("unexpected error creating database: %s", err)
+	}
+	return db
+}
+
+// testWaitLogs waits until the database holds count logs, and returns them.
+func testWaitLogs(t *testing.T, db *DB, count int) []log {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		logs, err := db.queryLogs(time.Time{}, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("unexpected error querying logs: %s", err)
+		}
+		if len(logs) >= count {
+			return logs
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d logs, got %d", count, len(logs))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// defaultOTLPAddress is the address of the OTLP/HTTP receiver when --otlp is
+// given without a value. It is the standard OTLP/HTTP port, on localhost.
+const defaultOTLPAddress = "localhost:4318"
+
+// otlpLogsRequest is an OTLP/JSON logs export, as sent to /v1/logs or written
+// by the OpenTelemetry collector file exporter.
+type otlpLogsRequest struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []otlpKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			Scope struct {
+				Name       string         `json:"name"`
+				Version    string         `json:"version"`
+				Attributes []otlpKeyValue `json:"attributes"`
+			} `json:"scope"`
+			LogRecords []otlpLogRecord `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 *otlpAnyValue  `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes"`
+	TraceID              string         `json:"traceId"`
+	SpanID               string         `json:"spanId"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+// otlpAnyValue holds one of its fields. Integers are encoded as strings in
+// OTLP/JSON, which json.Number accepts.
+type otlpAnyValue struct {
+	StringValue *string      `json:"stringValue"`
+	BoolValue   *bool        `json:"boolValue"`
+	IntValue    *json.Number `json:"intValue"`
+	DoubleValue *float64     `json:"doubleValue"`
+	BytesValue  *string      `json:"bytesValue"`
+	ArrayValue  *struct {
+		Values []otlpAnyValue `json:"values"`
+	} `json:"arrayValue"`
+	KvlistValue *struct {
+		Values []otlpKeyValue `json:"values"`
+	} `json:"kvlistValue"`
+}
+
+// otlpSeverities maps OpenTelemetry severity number ranges to severities.
+// Each range holds 4 numbers, starting at 1.
+var otlpSeverities = []severity{
+	severityTrace, severityDebug, severityInfo, severityWarn, severityError, severityFatal,
+}
+
+// isOTLP reports whether line looks like an OTLP/JSON logs export.
+func isOTLP(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("{")) && bytes.Contains(line, []byte(`"resourceLogs"`))
+}
+
+// isOTLPStream reports whether data starts with an OTLP/JSON logs export,
+// which may be indented.
+func isOTLPStream(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	if !bytes.HasPrefix(data, []byte("{")) {
+		return false
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(data[1:]), []byte(`"resourceLogs"`))
+}
+
+// scanOTLP appends the logs of a stream of OTLP/JSON logs exports, such as a
+// file written by the OpenTelemetry collector.
+func scanOTLP(r io.Reader, source string, db *DB) error {
+	var fields map[string]any
+	if source != "" {
+		fields = map[string]any{"source": source}
+	}
+	slog.Info("reading OTLP logs", "source", source)
+
+	decoder := json.NewDecoder(r)
+	for {
+		var data json.RawMessage
+		err := decoder.Decode(&data)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid OTLP logs: %w", err)
+		}
+		_, err = appendOTLP(db, data, fields)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseOTLP converts an OTLP/JSON logs export into log data. Resource and
+// scope attributes are nested under "resource" and "scope", and log
+// attributes are added as fields.
+func parseOTLP(data []byte) ([]map[string]any, error) {
+	var req otlpLogsRequest
+	err := json.Unmarshal(data, &req)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP logs: %w", err)
+	}
+
+	logs := []map[string]any{}
+	for _, rl := range req.ResourceLogs {
+		resource := otlpAttributes(rl.Resource.Attributes)
+		for _, sl := range rl.ScopeLogs {
+			scope := otlpAttributes(sl.Scope.Attributes)
+			if sl.Scope.Name != "" {
+				scope["name"] = sl.Scope.Name
+			}
+			if sl.Scope.Version != "" {
+				scope["version"] = sl.Scope.Version
+			}
+			for _, r := range sl.LogRecords {
+				logData := otlpRecord(r)
+				if len(resource) > 0 {
+					logData["resource"] = resource
+				}
+				if len(scope) > 0 {
+					logData["scope"] = scope
+				}
+				logs = append(logs, logData)
+			}
+		}
+	}
+	return logs, nil
+}
+
+func otlpRecord(r otlpLogRecord) map[string]any {
+	logData := otlpAttributes(r.Attributes)
+
+	ts := r.TimeUnixNano
+	if ts == "" || ts == "0" {
+		ts = r.ObservedTimeUnixNano
+	}
+	if nsec, err := strconv.ParseInt(ts, 10, 64); err == nil && nsec > 0 {
+		logData["timestamp"] = time.Unix(0, nsec).UTC().Format(time.RFC3339Nano)
+	}
+
+	if r.SeverityNumber > 0 && r.SeverityNumber <= 4*len(otlpSeverities) {
+		logData["level"] = otlpSeverities[(r.SeverityNumber-1)/4].String()
+	} else if r.SeverityText != "" {
+		logData["level"] = r.SeverityText
+	}
+	if r.SeverityText != "" {
+		logData["severity_text"] = r.SeverityText
+	}
+
+	if r.Body != nil {
+		switch body := r.Body.value().(type) {
+		case map[string]any:
+			for k, v := range body {
+				logData[k] = v
+			}
+		case string:
+			logData["msg"] = body
+		default:
+			logData["msg"] = fmt.Sprint(body)
+		}
+	}
+
+	if r.TraceID != "" {
+		logData["trace_id"] = r.TraceID
+	}
+	if r.SpanID != "" {
+		logData["span_id"] = r.SpanID
+	}
+	return logData
+}
+
+func otlpAttributes(kvs []otlpKeyValue) map[string]any {
+	attrs := make(map[string]any, len(kvs))
+	for _, kv := range kvs {
+		attrs[kv.Key] = kv.Value.value()
+	}
+	return attrs
+}
+
+// value returns v as a value decoded from JSON.
+func (v otlpAnyValue) value() any {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return otlpInt(*v.IntValue)
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.BytesValue != nil:
+		// bytes are kept base64-encoded
+		return *v.BytesValue
+	case v.ArrayValue != nil:
+		values := make([]any, 0, len(v.ArrayValue.Values))
+		for _, item := range v.ArrayValue.Values {
+			values = append(values, item.value())
+		}
+		return values
+	case v.KvlistValue != nil:
+		return otlpAttributes(v.KvlistValue.Values)
+	default:
+		return nil
+	}
+}
+
+// maxExactInt is the largest integer such that it and every smaller integer
+// are held exactly by a float64.
+const maxExactInt = 1 << 53
+
+// otlpInt returns a 64-bit integer value as a number, or as its decimal string
+// when a float64 can't hold it exactly, such as an ID or a count of
+// nanoseconds.
+func otlpInt(n json.Number) any {
+	i, err := n.Int64()
+	if err != nil || i > maxExactInt || i < -maxExactInt {
+		return n.String()
+	}
+	return float64(i)
+}
+
+// appendOTLP appends the log records of an OTLP/JSON logs export. It returns
+// the number of records appended.
+func appendOTLP(db *DB, data []byte, fields map[string]any) (int, error) {
+	logs, err := parseOTLP(data)
+	if err != nil {
+		return 0, err
+	}
+	for i, logData := range logs {
+		logJSON, err := json.Marshal(logData)
+		if err != nil {
+			return i, fmt.Errorf("couldn't convert OTLP log record: %w", err)
+		}
+		err = db.appendLogWithFields(logJSON, fields)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(logs), nil
+}
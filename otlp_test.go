@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testOTLPLogs = `{"resourceLogs":[{
+	"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"checkout"}}]},
+	"scopeLogs":[{
+		"scope":{"name":"checkout.http","version":"1.2.0"},
+		"logRecords":[
+			{
+				"timeUnixNano":"1690223651241000000",
+				"severityNumber":17,
+				"severityText":"ERROR",
+				"body":{"stringValue":"payment failed"},
+				"attributes":[
+					{"key":"http.status_code","value":{"intValue":"502"}},
+					{"key":"retry","value":{"boolValue":true}},
+					{"key":"tags","value":{"arrayValue":{"values":[{"stringValue":"a"},{"doubleValue":1.5}]}}}
+				],
+				"traceId":"5b8efff798038103d269b633813fc60c",
+				"spanId":"eee19b7ec3c1b174"
+			},
+			{
+				"observedTimeUnixNano":"1690223652000000000",
+				"severityNumber":9,
+				"body":{"kvlistValue":{"values":[{"key":"msg","value":{"stringValue":"structured"}}]}}
+			}
+		]
+	}]
+}]}`
+
+func TestParseOTLP(t *testing.T) {
+	logs, err := parseOTLP([]byte(testOTLPLogs))
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]map[string]any{
+			{
+				"timestamp":        "2023-07-24T18:34:11.241Z",
+				"level":            "error",
+				"severity_text":    "ERROR",
+				"msg":              "payment failed",
+				"http.status_code": float64(502),
+				"retry":            true,
+				"tags":             []any{"a", 1.5},
+				"trace_id":         "5b8efff798038103d269b633813fc60c",
+				"span_id":          "eee19b7ec3c1b174",
+				"resource":         map[string]any{"service.name": "checkout"},
+				"scope":            map[string]any{"name": "checkout.http", "version": "1.2.0"},
+			},
+			{
+				"timestamp": "2023-07-24T18:34:12Z",
+				"level":     "info",
+				"msg":       "structured",
+				"resource":  map[string]any{"service.name": "checkout"},
+				"scope":     map[string]any{"name": "checkout.http", "version": "1.2.0"},
+			},
+		},
+		logs,
+	)
+
+	_, err = parseOTLP([]byte(`{"resourceLogs":"nope"}`))
+	assert.Error(t, err)
+}
+
+func TestOTLPInt(t *testing.T) {
+	assert.Equal(t, float64(502), otlpInt("502"))
+	assert.Equal(t, float64(-maxExactInt), otlpInt("-9007199254740992"))
+	assert.Equal(t, "9007199254740993", otlpInt("9007199254740993"))
+	assert.Equal(t, "1690223651241000123", otlpInt("1690223651241000123"))
+	assert.Equal(t, "18446744073709551615", otlpInt("18446744073709551615"))
+}
+
+func TestScanOTLP(t *testing.T) {
+	assert.True(t, isOTLPStream([]byte("{\n  \"resourceLogs\": [")))
+	assert.False(t, isOTLPStream([]byte(`{"msg":"resourceLogs"}`)))
+
+	db := testOpenDatabase(t)
+	in := testOTLPLogs + "\n" + testOTLPLogs
+	assert.NoError(t, scanArchive(bytes.NewReader([]byte(in)), "", db))
+
+	logs := testWaitLogs(t, db, 4)
+	assert.Len(t, logs, 4)
+	assert.Equal(t, "structured", logs[0].message)
+	assert.Equal(t, time.Date(2023, time.July, 24, 18, 34, 11, 241000000, time.UTC), logs[3].timestamp.UTC())
+	assert.Equal(t, severityError, logs[3].severity)
+
+	c, err := parseCondition("resource.service.name == checkout && trace_id")
+	assert.NoError(t, err)
+	assert.Len(t, filterLogs(logs, c), 2)
+}
+
+func TestHTTPIngestOTLP(t *testing.T) {
+	db := testOpenDatabase(t)
+	handler := newHTTPHandler(db)
+
+	rec := testPost(t, handler, "/v1/logs", testOTLPLogs)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{}`, rec.Body.String())
+
+	rec = testPost(t, handler, "/v1/logs", `{"resourceLogs":[`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	logs := testWaitLogs(t, db, 2)
+	assert.Len(t, logs, 2)
+	assert.Equal(t, "payment failed", logs[1].message)
+	assert.Equal(t, "192.0.2.1:1234", logs[1].data["peer"])
+}
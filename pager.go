@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// defaultPager is run when neither PAGER nor EDITOR is set.
+const defaultPager = "less"
+
+// pagerCommand returns the command logs are opened with: $PAGER, or $EDITOR.
+func pagerCommand() string {
+	for _, env := range []string{"PAGER", "EDITOR"} {
+		if command := os.Getenv(env); command != "" {
+			return command
+		}
+	}
+	return defaultPager
+}
+
+// writePrettyLogs writes indented JSON: the log itself if there is only one,
+// or an array of logs.
+func writePrettyLogs(w io.Writer, logs []log) error {
+	var v any
+	if len(logs) == 1 {
+		v = logs[0].data
+	} else {
+		data := make([]map[string]any, 0, len(logs))
+		for _, l := range logs {
+			data = append(data, l.data)
+		}
+		v = data
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(v)
+	if err != nil {
+		return fmt.Errorf("couldn't encode logs: %w", err)
+	}
+	return nil
+}
+
+// writeTempLogs writes logs as pretty JSON to a new temporary file, and
+// returns its path.
+func writeTempLogs(logs []log) (string, error) {
+	f, err := os.CreateTemp("", "ltop-*.json")
+	if err != nil {
+		return "", fmt.Errorf("couldn't create temporary file: %w", err)
+	}
+	err = writePrettyLogs(f, logs)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("couldn't write temporary file: %w", closeErr)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// openFile runs command with the shell on the file at path, attached to the
+// terminal rather than to the standard streams, since logs may be read from
+// standard input.
+func openFile(command, path string) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("couldn't open terminal: %w", err)
+	}
+	defer tty.Close()
+
+	cmd := exec.Command("sh", "-c", command+` "$1"`, "ltop", path)
+	cmd.Stdin = tty
+	cmd.Stdout = tty
+	cmd.Stderr = tty
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("couldn't run %s: %w", command, err)
+	}
+	return nil
+}
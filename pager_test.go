@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPagerCommand(t *testing.T) {
+	t.Setenv("PAGER", "")
+	t.Setenv("EDITOR", "")
+	assert.Equal(t, "less", pagerCommand())
+	t.Setenv("EDITOR", "vim")
+	assert.Equal(t, "vim", pagerCommand())
+	t.Setenv("PAGER", "less -S")
+	assert.Equal(t, "less -S", pagerCommand())
+}
+
+func TestWritePrettyLogs(t *testing.T) {
+	buf := bytes.Buffer{}
+	assert.NoError(t, writePrettyLogs(&buf, []log{{data: map[string]any{"msg": "a"}}}))
+	assert.Equal(t, "{\n  \"msg\": \"a\"\n}\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, writePrettyLogs(&buf, []log{
+		{data: map[string]any{"msg": "a"}},
+		{data: map[string]any{"msg": "b"}},
+	}))
+	assert.Equal(t, "[\n  {\n    \"msg\": \"a\"\n  },\n  {\n    \"msg\": \"b\"\n  }\n]\n", buf.String())
+}
+
+func TestWriteTempLogs(t *testing.T) {
+	path, err := writeTempLogs([]log{{data: map[string]any{"msg": "a"}}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.Remove(path)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\n  \"msg\": \"a\"\n}\n", string(data))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+const (
+	// pipeTimeout is how long a command piped logs can run before it is
+	// killed.
+	pipeTimeout = 30 * time.Second
+	// maxPipeOutput is the number of bytes of output shown.
+	maxPipeOutput = 1 << 20
+)
+
+// pipeLogs runs command with the shell, with the JSON of logs on stdin, one
+// per line. It returns the combined stdout and stderr of the command, of which
+// only the first maxPipeOutput bytes are kept, and a description of how it
+// exited.
+func pipeLogs(command string, logs []log) (string, string, error) {
+	input := bytes.Buffer{}
+	err := writeLogs(&input, logs)
+	if err != nil {
+		return "", "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pipeTimeout)
+	defer cancel()
+	// the command runs in its own process group, so that the commands of a
+	// pipeline are killed with it
+	cmd := shellCommand(ctx, command)
+	cmd.Stdin = &input
+	output := limitedBuffer{max: maxPipeOutput}
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err = cmd.Run()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// the command exited, but a process it started in the background
+		// kept the output open
+		err = nil
+	}
+
+	status := "exited with status 0"
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		status = fmt.Sprintf("killed after %s", pipeTimeout)
+	case errors.As(err, &exitErr):
+		status = fmt.Sprintf("exited with status %d", exitErr.ExitCode())
+	case err != nil:
+		return "", "", fmt.Errorf("couldn't run command: %w", err)
+	}
+	text := output.buf.String()
+	if output.truncated {
+		text += "\n[output truncated]"
+	}
+	return text, status, nil
+}
+
+// limitedBuffer keeps the first max bytes written to it, and discards the
+// rest.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.max - b.buf.Len(); len(p) > room {
+		p = p[:room]
+		b.truncated = true
+	}
+	b.buf.Write(p)
+	// report the whole write, so that the command isn't stopped
+	return n, nil
+}
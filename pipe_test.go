@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipeLogs(t *testing.T) {
+	logs := []log{
+		{data: map[string]any{"msg": "a"}},
+		{data: map[string]any{"msg": "b"}},
+	}
+
+	output, status, err := pipeLogs("cat", logs)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"msg\":\"a\"}\n{\"msg\":\"b\"}\n", output)
+	assert.Equal(t, "exited with status 0", status)
+
+	output, status, err = pipeLogs("wc -l | tr -d ' '; echo failed >&2; exit 3", logs)
+	assert.NoError(t, err)
+	assert.Equal(t, "2\nfailed\n", output)
+	assert.Equal(t, "exited with status 3", status)
+}
+
+func TestPipeLogsLimits(t *testing.T) {
+	output, status, err := pipeLogs(`head -c 2000000 /dev/zero | tr '\0' a`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("a", maxPipeOutput)+"\n[output truncated]", output)
+	assert.Equal(t, "exited with status 0", status)
+
+	// a background process keeps the output open after the command exited
+	start := time.Now()
+	output, status, err = pipeLogs("sleep 5 & echo done", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "done\n", output)
+	assert.Equal(t, "exited with status 0", status)
+	assert.Less(t, time.Since(start), 3*time.Second)
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	b := limitedBuffer{max: 4}
+	n, err := b.Write([]byte("abc"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.False(t, b.truncated)
+	n, err = b.Write([]byte("def"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.True(t, b.truncated)
+	assert.Equal(t, "abcd", b.buf.String())
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	minReplaySpeed = 1.0 / 64
+	maxReplaySpeed = 1024
+	// replayTick is the longest sleep while waiting for a log, so that speed
+	// and pause changes apply quickly.
+	replayTick = 50 * time.Millisecond
+)
+
+// replayer paces the ingestion of logs by their timestamps, on a replay clock
+// running at speed times real time. The clock starts at the timestamp of the
+// first log.
+type replayer struct {
+	mu     sync.Mutex
+	speed  float64
+	paused bool
+	// steps is the number of logs to let through while paused.
+	steps int
+	// the replay clock was at clock at wall time anchor
+	clock  time.Time
+	anchor time.Time
+}
+
+func newReplayer(speed float64) *replayer {
+	return &replayer{speed: speed}
+}
+
+// parseSpeed parses a replay speed such as "10x", "0.5x" or "2".
+func parseSpeed(s string) (float64, error) {
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(s), "x"), 64)
+	if err != nil || speed < minReplaySpeed || speed > maxReplaySpeed {
+		return 0, fmt.Errorf("invalid replay speed: \"%s\"", s)
+	}
+	return speed, nil
+}
+
+// now returns the time on the replay clock. It must be called with r.mu held.
+func (r *replayer) now(wall time.Time) time.Time {
+	if r.paused {
+		return r.clock
+	}
+	return r.clock.Add(time.Duration(float64(wall.Sub(r.anchor)) * r.speed))
+}
+
+// setClock sets the replay clock. It must be called with r.mu held.
+func (r *replayer) setClock(clock time.Time, wall time.Time) {
+	r.clock = clock
+	r.anchor = wall
+}
+
+// wait blocks until the replay clock reaches ts. While paused, it blocks until
+// the replay is resumed or stepped.
+func (r *replayer) wait(ts time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.clock.IsZero() {
+		r.setClock(ts, time.Now())
+	}
+	for {
+		wall := time.Now()
+		if r.paused {
+			if r.steps > 0 {
+				r.steps--
+				if ts.After(r.clock) {
+					r.setClock(ts, wall)
+				}
+				return
+			}
+		} else {
+			remaining := ts.Sub(r.now(wall))
+			if remaining <= 0 {
+				return
+			}
+			sleep := time.Duration(float64(remaining) / r.speed)
+			if sleep < replayTick {
+				r.mu.Unlock()
+				time.Sleep(sleep)
+				r.mu.Lock()
+				continue
+			}
+		}
+		r.mu.Unlock()
+		time.Sleep(replayTick)
+		r.mu.Lock()
+	}
+}
+
+// togglePause stops or restarts the replay clock.
+func (r *replayer) togglePause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	wall := time.Now()
+	r.setClock(r.now(wall), wall)
+	r.paused = !r.paused
+	r.steps = 0
+}
+
+// step lets the next log through while paused.
+func (r *replayer) step() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paused {
+		r.steps++
+	}
+}
+
+// scaleSpeed multiplies the speed by factor, within the speed limits.
+func (r *replayer) scaleSpeed(factor float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	wall := time.Now()
+	r.setClock(r.now(wall), wall)
+	r.speed *= factor
+	if r.speed < minReplaySpeed {
+		r.speed = minReplaySpeed
+	}
+	if r.speed > maxReplaySpeed {
+		r.speed = maxReplaySpeed
+	}
+}
+
+// status describes the replay for the header, e.g. "replay 10x, paused".
+func (r *replayer) status() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	text := "replay " + strconv.FormatFloat(r.speed, 'f', -1, 64) + "x"
+	if r.paused {
+		text += ", paused"
+	}
+	return text
+}
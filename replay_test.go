@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSpeed(t *testing.T) {
+	type testCase struct {
+		in     string
+		expect float64
+		err    bool
+	}
+	testCases := []testCase{
+		{in: "10x", expect: 10},
+		{in: "0.5x", expect: 0.5},
+		{in: "2", expect: 2},
+		{in: "1X", expect: 1},
+		{in: "0x", err: true},
+		{in: "-2x", err: true},
+		{in: "fast", err: true},
+		{in: "", err: true},
+	}
+	for _, c := range testCases {
+		t.Run(c.in, func(t *testing.T) {
+			got, err := parseSpeed(c.in)
+			if c.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expect, got)
+		})
+	}
+}
+
+func TestReplayerWait(t *testing.T) {
+	r := newReplayer(100)
+	ts := time.Date(2023, time.July, 24, 18, 34, 11, 0, time.UTC)
+
+	start := time.Now()
+	r.wait(ts)
+	assert.Less(t, time.Since(start), 10*time.Millisecond, "first log is not delayed")
+
+	// 3 seconds at 100x take 30ms
+	r.wait(ts.Add(time.Second))
+	r.wait(ts.Add(3 * time.Second))
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+
+	// logs out of order are not delayed
+	start = time.Now()
+	r.wait(ts)
+	assert.Less(t, time.Since(start), 10*time.Millisecond)
+}
+
+func TestReplayerPause(t *testing.T) {
+	r := newReplayer(1)
+	ts := time.Date(2023, time.July, 24, 18, 34, 11, 0, time.UTC)
+	r.wait(ts)
+
+	r.togglePause()
+	assert.Equal(t, "replay 1x, paused", r.status())
+
+	done := make(chan struct{})
+	go func() {
+		r.wait(ts.Add(time.Hour))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected wait to block while paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	r.step()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected step to release the next log")
+	}
+
+	r.togglePause()
+	r.scaleSpeed(2)
+	assert.Equal(t, "replay 2x", r.status())
+	r.scaleSpeed(1e6)
+	assert.Equal(t, "replay 1024x", r.status())
+}
+
+func TestAppendLogReplay(t *testing.T) {
+	db := testOpenDatabase(t)
+	db.replay = newReplayer(50)
+
+	start := time.Now()
+	assert.NoError(t, db.appendLog([]byte(`{"timestamp":"2023-07-24T18:34:11Z","msg":"one"}`)))
+	assert.NoError(t, db.appendLog([]byte(`{"msg":"no timestamp"}`)))
+	assert.NoError(t, db.appendLog([]byte(`{"timestamp":"2023-07-24T18:34:12Z","msg":"two"}`)))
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 20*time.Millisecond)
+	assert.Less(t, elapsed, time.Second)
+}
@@ -0,0 +1,36 @@
+package main
+
+// logSchema reads the timestamp, level and message of logs written in a
+// well-known schema, which names them differently from ltop.
+type logSchema struct {
+	name   string
+	detect func(logData map[string]any) bool
+	fields func(logData map[string]any) schemaFields
+}
+
+// schemaFields are the timestamp, level and message of a log, read from the
+// fields of its schema. Nil values are found in the usual fields instead.
+type schemaFields struct {
+	timestamp any
+	level     any
+	message   any
+}
+
+// logSchemas are tried in order, and the first detected schema is used.
+var logSchemas = []logSchema{
+	{name: "journald", detect: isJournalJSON, fields: journalFields},
+	{name: "gelf", detect: isGELF, fields: gelfFields},
+	{name: "ecs", detect: isECS, fields: ecsFields},
+}
+
+// findSchemaFields returns the timestamp, level and message of logData if it
+// is written in a known schema. The log itself is left as is, so that it is
+// stored, shown and copied as it was sent.
+func findSchemaFields(logData map[string]any) schemaFields {
+	for _, s := range logSchemas {
+		if s.detect(logData) {
+			return s.fields(logData)
+		}
+	}
+	return schemaFields{}
+}
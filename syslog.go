@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// isSyslog reports whether line starts with a syslog priority, e.g. "<34>".
+func isSyslog(line []byte) bool {
+	if len(line) < 3 || line[0] != '<' {
+		return false
+	}
+	end := bytes.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return false
+	}
+	_, err := strconv.Atoi(string(line[1:end]))
+	return err == nil
+}
+
+// parseSyslog parses an RFC5424 or RFC3164 syslog message into log data.
+// When the message itself is a JSON object, its fields are merged in and
+// take precedence over the syslog header.
+func parseSyslog(line []byte) (map[string]any, error) {
+	if !isSyslog(line) {
+		return nil, fmt.Errorf("missing syslog priority")
+	}
+	end := bytes.IndexByte(line, '>')
+	pri, _ := strconv.Atoi(string(line[1:end]))
+	if pri > 191 {
+		return nil, fmt.Errorf("invalid syslog priority: %d", pri)
+	}
+
+	logData := map[string]any{
+		"level":    syslogSeverities[pri%8].String(),
+		"facility": syslogFacilities[pri/8],
+	}
+
+	rest := string(line[end+1:])
+	var msg string
+	var err error
+	if strings.HasPrefix(rest, "1 ") {
+		msg, err = parseRFC5424(rest[2:], logData)
+	} else {
+		msg, err = parseRFC3164(rest, logData)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var msgData map[string]any
+	if strings.HasPrefix(msg, "{") && json.Unmarshal([]byte(msg), &msgData) == nil {
+		for k, v := range msgData {
+			logData[k] = v
+		}
+	} else {
+		logData["msg"] = msg
+	}
+	return logData, nil
+}
+
+// parseRFC5424 parses the header fields following the version and returns the
+// message.
+func parseRFC5424(s string, logData map[string]any) (string, error) {
+	fields := []string{"timestamp", "hostname", "app", "procid", "msgid"}
+	for _, name := range fields {
+		var value string
+		var ok bool
+		value, s, ok = strings.Cut(s, " ")
+		if !ok && name != "msgid" {
+			return "", fmt.Errorf("truncated syslog header")
+		}
+		if value != "-" {
+			logData[name] = value
+		}
+	}
+
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	} else if strings.HasPrefix(s, "[") {
+		sd, rest, err := parseStructuredData(s)
+		if err != nil {
+			return "", err
+		}
+		logData["structured_data"] = sd
+		s = rest
+	}
+
+	s = strings.TrimPrefix(s, " ")
+	return strings.TrimPrefix(s, "\ufeff"), nil
+}
+
+// parseStructuredData parses RFC5424 structured data elements such as
+// `[id key="value"]` and returns the rest of the line.
+func parseStructuredData(s string) (map[string]any, string, error) {
+	sd := map[string]any{}
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+		i := strings.IndexAny(s, " ]")
+		if i < 0 {
+			return nil, "", fmt.Errorf("unterminated structured data")
+		}
+		params := map[string]any{}
+		sd[s[:i]] = params
+		s = s[i:]
+		for strings.HasPrefix(s, " ") {
+			s = s[1:]
+			name, rest, ok := strings.Cut(s, "=\"")
+			if !ok {
+				return nil, "", fmt.Errorf("invalid structured data parameter")
+			}
+			value := strings.Builder{}
+			escaped := false
+			closed := false
+			for i, r := range rest {
+				switch {
+				case escaped:
+					value.WriteRune(r)
+					escaped = false
+				case r == '\\':
+					escaped = true
+				case r == '"':
+					s = rest[i+1:]
+					closed = true
+				default:
+					value.WriteRune(r)
+				}
+				if closed {
+					break
+				}
+			}
+			if !closed {
+				return nil, "", fmt.Errorf("unterminated structured data parameter")
+			}
+			params[name] = value.String()
+		}
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", fmt.Errorf("unterminated structured data")
+		}
+		s = s[1:]
+	}
+	return sd, s, nil
+}
+
+// parseRFC3164 parses a BSD syslog header, e.g.
+// "Oct 11 22:14:15 mymachine su[123]: message", and returns the message.
+// Missing header fields are tolerated.
+func parseRFC3164(s string, logData map[string]any) (string, error) {
+	if len(s) >= len(time.Stamp) {
+		if ts, err := time.Parse(time.Stamp, s[:len(time.Stamp)]); err == nil {
+			logData["timestamp"] = completeDate(ts, time.Stamp).Format(time.RFC3339Nano)
+			s = strings.TrimPrefix(s[len(time.Stamp):], " ")
+
+			hostname, rest, ok := strings.Cut(s, " ")
+			if ok && !strings.HasSuffix(hostname, ":") {
+				logData["hostname"] = hostname
+				s = rest
+			}
+		}
+	}
+
+	tag, msg, ok := strings.Cut(s, ": ")
+	if ok && tag != "" && !strings.ContainsAny(tag, " ") {
+		if app, pid, ok := strings.Cut(tag, "["); ok {
+			logData["app"] = app
+			logData["procid"] = strings.TrimSuffix(pid, "]")
+		} else {
+			logData["app"] = tag
+		}
+		s = msg
+	}
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "�")
+	}
+	return s, nil
+}
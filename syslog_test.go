@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSyslog(t *testing.T) {
+	assert.True(t, isSyslog([]byte("<34>Oct 11 22:14:15 mymachine su: hello")))
+	assert.True(t, isSyslog([]byte("<0>1 - - - - - -")))
+	assert.False(t, isSyslog([]byte(`{"level":"info"}`)))
+	assert.False(t, isSyslog([]byte("<html>")))
+	assert.False(t, isSyslog([]byte("<>")))
+}
+
+func TestParseSyslog(t *testing.T) {
+	type testCase struct {
+		name   string
+		in     string
+		expect map[string]any
+		err    bool
+	}
+	testCases := []testCase{
+		{
+			name: "RFC5424",
+			in:   `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application"] An application event`,
+			expect: map[string]any{
+				"level":     "notice",
+				"facility":  "local4",
+				"timestamp": "2003-10-11T22:14:15.003Z",
+				"hostname":  "mymachine.example.com",
+				"app":       "evntslog",
+				"msgid":     "ID47",
+				"structured_data": map[string]any{
+					"exampleSDID@32473": map[string]any{"iut": "3", "eventSource": "Application"},
+				},
+				"msg": "An application event",
+			},
+		},
+		{
+			name: "RFC5424 nil values",
+			in:   `<11>1 - - app 1234 - - {"msg":"failed","status":500}`,
+			expect: map[string]any{
+				"level":    "error",
+				"facility": "user",
+				"app":      "app",
+				"procid":   "1234",
+				"msg":      "failed",
+				"status":   float64(500),
+			},
+		},
+		{
+			name: "RFC5424 escaped structured data",
+			in:   `<14>1 - - - - - [a x="say \"hi\" \]"][b] hello`,
+			expect: map[string]any{
+				"level":           "info",
+				"facility":        "user",
+				"structured_data": map[string]any{"a": map[string]any{"x": `say "hi" ]`}, "b": map[string]any{}},
+				"msg":             "hello",
+			},
+		},
+		{
+			name: "RFC3164 without header",
+			in:   `<13>su[123]: 'su root' failed`,
+			expect: map[string]any{
+				"level":    "notice",
+				"facility": "user",
+				"app":      "su",
+				"procid":   "123",
+				"msg":      "'su root' failed",
+			},
+		},
+		{name: "invalid priority", in: "<999>hello", err: true},
+		{name: "truncated RFC5424", in: "<14>1 -", err: true},
+		{name: "unterminated structured data", in: `<14>1 - - - - - [a x="1`, err: true},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseSyslog([]byte(c.in))
+			if c.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expect, got)
+		})
+	}
+}
+
+func TestParseSyslogRFC3164(t *testing.T) {
+	got, err := parseSyslog([]byte("<34>Oct  1 22:14:15 mymachine su: 'su root' failed"))
+	assert.NoError(t, err)
+	assert.Equal(t, "critical", got["level"])
+	assert.Equal(t, "auth", got["facility"])
+	assert.Equal(t, "mymachine", got["hostname"])
+	assert.Equal(t, "su", got["app"])
+	assert.Equal(t, "'su root' failed", got["msg"])
+
+	ts, err := parseTime(got["timestamp"])
+	assert.NoError(t, err)
+	assert.Equal(t, "Oct  1 22:14:15", ts.Format(timeLayoutNames["Stamp"]))
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// theme holds the colors of the user interface. Text view colors are stored
+// as tview color tags.
+type theme struct {
+	name   string
+	styles tview.Theme
+	header tcell.Style
+	levels map[severity]tcell.Style
+	// noColor drops the colors of highlight rules, keeping only attributes.
+	noColor  bool
+	keyTag   string
+	labelTag string
+	errorTag string
+}
+
+var defaultStyle = tcell.StyleDefault
+
+var themes = map[string]*theme{
+	"dark": {
+		name:   "dark",
+		styles: tview.Styles,
+		header: defaultStyle.Foreground(tcell.ColorBlack).Background(tcell.ColorPurple),
+		levels: map[severity]tcell.Style{
+			severityTrace:     defaultStyle.Foreground(tcell.ColorBlack).Background(tcell.ColorGray),
+			severityDebug:     defaultStyle.Foreground(tcell.ColorBlack).Background(tcell.ColorGreen),
+			severityInfo:      defaultStyle.Foreground(tcell.ColorBlack).Background(tcell.ColorBlue),
+			severityNotice:    defaultStyle.Foreground(tcell.ColorBlack).Background(tcell.ColorTeal),
+			severityWarn:      defaultStyle.Foreground(tcell.ColorBlack).Background(tcell.ColorYellow),
+			severityError:     defaultStyle.Foreground(tcell.ColorBlack).Background(tcell.ColorRed),
+			severityCritical:  defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorFuchsia),
+			severityAlert:     defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorFuchsia),
+			severityFatal:     defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorMaroon),
+			severityPanic:     defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorMaroon),
+			severityEmergency: defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorMaroon),
+		},
+		keyTag:   "[yellow]",
+		labelTag: "[black:teal]",
+		errorTag: "[red]",
+	},
+	"light": {
+		name: "light",
+		styles: tview.Theme{
+			PrimitiveBackgroundColor:    tcell.ColorWhite,
+			ContrastBackgroundColor:     tcell.ColorSilver,
+			MoreContrastBackgroundColor: tcell.ColorLightGreen,
+			BorderColor:                 tcell.ColorBlack,
+			TitleColor:                  tcell.ColorBlack,
+			GraphicsColor:               tcell.ColorBlack,
+			PrimaryTextColor:            tcell.ColorBlack,
+			SecondaryTextColor:          tcell.ColorNavy,
+			TertiaryTextColor:           tcell.ColorGreen,
+			InverseTextColor:            tcell.ColorWhite,
+			ContrastSecondaryTextColor:  tcell.ColorNavy,
+		},
+		header: defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorNavy),
+		levels: map[severity]tcell.Style{
+			severityTrace:     defaultStyle.Foreground(tcell.ColorBlack).Background(tcell.ColorSilver),
+			severityDebug:     defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorGreen),
+			severityInfo:      defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorBlue),
+			severityNotice:    defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorTeal),
+			severityWarn:      defaultStyle.Foreground(tcell.ColorBlack).Background(tcell.ColorGold),
+			severityError:     defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorRed),
+			severityCritical:  defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorPurple),
+			severityAlert:     defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorPurple),
+			severityFatal:     defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorMaroon),
+			severityPanic:     defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorMaroon),
+			severityEmergency: defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorMaroon),
+		},
+		keyTag:   "[navy]",
+		labelTag: "[white:navy]",
+		errorTag: "[maroon]",
+	},
+	"high-contrast": {
+		name: "high-contrast",
+		styles: tview.Theme{
+			PrimitiveBackgroundColor:    tcell.ColorBlack,
+			ContrastBackgroundColor:     tcell.ColorWhite,
+			MoreContrastBackgroundColor: tcell.ColorYellow,
+			BorderColor:                 tcell.ColorWhite,
+			TitleColor:                  tcell.ColorWhite,
+			GraphicsColor:               tcell.ColorWhite,
+			PrimaryTextColor:            tcell.ColorWhite,
+			SecondaryTextColor:          tcell.ColorYellow,
+			TertiaryTextColor:           tcell.ColorAqua,
+			InverseTextColor:            tcell.ColorBlack,
+			ContrastSecondaryTextColor:  tcell.ColorBlack,
+		},
+		header: defaultStyle.Foreground(tcell.ColorBlack).Background(tcell.ColorWhite).Bold(true),
+		levels: map[severity]tcell.Style{
+			severityTrace:     defaultStyle.Foreground(tcell.ColorWhite),
+			severityDebug:     defaultStyle.Foreground(tcell.ColorBlack).Background(tcell.ColorLime),
+			severityInfo:      defaultStyle.Foreground(tcell.ColorBlack).Background(tcell.ColorAqua),
+			severityNotice:    defaultStyle.Foreground(tcell.ColorBlack).Background(tcell.ColorAqua),
+			severityWarn:      defaultStyle.Foreground(tcell.ColorBlack).Background(tcell.ColorYellow).Bold(true),
+			severityError:     defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorRed).Bold(true),
+			severityCritical:  defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorFuchsia).Bold(true),
+			severityAlert:     defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorFuchsia).Bold(true),
+			severityFatal:     defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorRed).Bold(true).Underline(true),
+			severityPanic:     defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorRed).Bold(true).Underline(true),
+			severityEmergency: defaultStyle.Foreground(tcell.ColorWhite).Background(tcell.ColorRed).Bold(true).Underline(true),
+		},
+		keyTag:   "[yellow::b]",
+		labelTag: "[black:white:b]",
+		errorTag: "[red::b]",
+	},
+	"monochrome": {
+		name: "monochrome",
+		styles: tview.Theme{
+			PrimitiveBackgroundColor:    tcell.ColorDefault,
+			ContrastBackgroundColor:     tcell.ColorDefault,
+			MoreContrastBackgroundColor: tcell.ColorDefault,
+			BorderColor:                 tcell.ColorDefault,
+			TitleColor:                  tcell.ColorDefault,
+			GraphicsColor:               tcell.ColorDefault,
+			PrimaryTextColor:            tcell.ColorDefault,
+			SecondaryTextColor:          tcell.ColorDefault,
+			TertiaryTextColor:           tcell.ColorDefault,
+			InverseTextColor:            tcell.ColorDefault,
+			ContrastSecondaryTextColor:  tcell.ColorDefault,
+		},
+		header: defaultStyle.Reverse(true),
+		levels: map[severity]tcell.Style{
+			severityTrace:     defaultStyle.Dim(true),
+			severityWarn:      defaultStyle.Bold(true),
+			severityError:     defaultStyle.Bold(true).Reverse(true),
+			severityCritical:  defaultStyle.Bold(true).Reverse(true),
+			severityAlert:     defaultStyle.Bold(true).Reverse(true),
+			severityFatal:     defaultStyle.Bold(true).Reverse(true).Underline(true),
+			severityPanic:     defaultStyle.Bold(true).Reverse(true).Underline(true),
+			severityEmergency: defaultStyle.Bold(true).Reverse(true).Underline(true),
+		},
+		noColor:  true,
+		keyTag:   "[::b]",
+		labelTag: "[::r]",
+		errorTag: "[::b]",
+	},
+}
+
+// selectTheme returns the named theme, or the monochrome theme when the
+// NO_COLOR environment variable is set (see https://no-color.org).
+func selectTheme(name string) (*theme, error) {
+	if os.Getenv("NO_COLOR") != "" {
+		return themes["monochrome"], nil
+	}
+	if name == "" {
+		name = "dark"
+	}
+	th, ok := themes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown theme: \"%s\"", name)
+	}
+	return th, nil
+}
+
+// applyStyle sets the colors and attributes of style on cell. Default colors
+// are left unchanged.
+func applyStyle(cell *tview.TableCell, style tcell.Style) {
+	fg, bg, attr := style.Decompose()
+	if fg != tcell.ColorDefault {
+		cell.SetTextColor(fg)
+	}
+	if bg != tcell.ColorDefault {
+		cell.SetBackgroundColor(bg)
+	}
+	cell.SetAttributes(attr)
+}
+
+// highlightRule styles the rows of logs matching a condition.
+type highlightRule struct {
+	condition *condition
+	style     tcell.Style
+}
+
+// highlightRuleConfig is a highlight rule as written in the config file.
+type highlightRuleConfig struct {
+	Match      string `json:"match"`
+	Color      string `json:"color"`
+	Background string `json:"background"`
+	Bold       bool   `json:"bold"`
+	Underline  bool   `json:"underline"`
+}
+
+// newHighlightRules parses the highlight rules from the config file. With a
+// noColor theme, colors are dropped and rows without attributes are
+// reversed instead.
+func newHighlightRules(configs []highlightRuleConfig, th *theme) ([]highlightRule, error) {
+	rules := make([]highlightRule, 0, len(configs))
+	for _, rc := range configs {
+		c, err := parseCondition(rc.Match)
+		if err != nil {
+			return nil, err
+		}
+
+		style := defaultStyle.Bold(rc.Bold).Underline(rc.Underline)
+		if th.noColor {
+			if !rc.Bold && !rc.Underline {
+				style = style.Reverse(true)
+			}
+		} else {
+			if rc.Color != "" {
+				color := tcell.GetColor(rc.Color)
+				if color == tcell.ColorDefault {
+					return nil, fmt.Errorf("unknown color: \"%s\"", rc.Color)
+				}
+				style = style.Foreground(color)
+			}
+			if rc.Background != "" {
+				color := tcell.GetColor(rc.Background)
+				if color == tcell.ColorDefault {
+					return nil, fmt.Errorf("unknown color: \"%s\"", rc.Background)
+				}
+				style = style.Background(color)
+			}
+		}
+		rules = append(rules, highlightRule{condition: c, style: style})
+	}
+	return rules, nil
+}
+
+// matchRules returns the style of the first rule matching l.
+func matchRules(rules []highlightRule, l *log) (tcell.Style, bool) {
+	for _, r := range rules {
+		if r.condition.match(l) {
+			return r.style, true
+		}
+	}
+	return defaultStyle, false
+}
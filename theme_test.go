@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectTheme(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+
+	th, err := selectTheme("")
+	assert.NoError(t, err)
+	assert.Equal(t, "dark", th.name)
+
+	th, err = selectTheme("light")
+	assert.NoError(t, err)
+	assert.Equal(t, "light", th.name)
+
+	_, err = selectTheme("neon")
+	assert.Error(t, err)
+
+	t.Setenv("NO_COLOR", "1")
+	th, err = selectTheme("light")
+	assert.NoError(t, err)
+	assert.Equal(t, "monochrome", th.name)
+}
+
+func TestHighlightRules(t *testing.T) {
+	configs := []highlightRuleConfig{
+		{Match: "status>=500", Color: "red"},
+		{Match: "user.id=42", Background: "yellow", Bold: true},
+	}
+
+	rules, err := newHighlightRules(configs, themes["dark"])
+	assert.NoError(t, err)
+
+	style, ok := matchRules(rules, &log{data: map[string]any{"status": float64(502)}})
+	assert.True(t, ok)
+	assert.Equal(t, defaultStyle.Foreground(tcell.ColorRed), style)
+
+	style, ok = matchRules(rules, &log{
+		data: map[string]any{"user": map[string]any{"id": float64(42)}},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, defaultStyle.Background(tcell.ColorYellow).Bold(true), style)
+
+	_, ok = matchRules(rules, &log{data: map[string]any{"status": float64(200)}})
+	assert.False(t, ok)
+
+	rules, err = newHighlightRules(configs, themes["monochrome"])
+	assert.NoError(t, err)
+	style, _ = matchRules(rules, &log{data: map[string]any{"status": float64(502)}})
+	assert.Equal(t, defaultStyle.Reverse(true), style)
+
+	_, err = newHighlightRules([]highlightRuleConfig{{Match: "a=1", Color: "ultraviolet"}}, themes["dark"])
+	assert.Error(t, err)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+type timeMode int
+
+const (
+	timeModeLocal timeMode = iota
+	timeModeUTC
+	timeModeZone
+	timeModeRelative
+)
+
+const defaultTimeDisplayLayout = "2006-01-02 15:04:05.000 MST"
+
+// timeDisplay controls how timestamps are rendered in the table.
+type timeDisplay struct {
+	mode   timeMode
+	zone   *time.Location
+	layout string
+	// showDelta adds a column with the time elapsed since the previous log.
+	showDelta bool
+}
+
+func newTimeDisplay(zoneName, layout string) (timeDisplay, error) {
+	td := timeDisplay{mode: timeModeLocal, layout: defaultTimeDisplayLayout}
+	if layout != "" {
+		td.layout = layout
+	}
+	switch zoneName {
+	case "", "Local", "local":
+	case "UTC", "utc":
+		td.mode = timeModeUTC
+	default:
+		zone, err := time.LoadLocation(zoneName)
+		if err != nil {
+			return td, fmt.Errorf("invalid time zone: %w", err)
+		}
+		td.zone = zone
+		td.mode = timeModeZone
+	}
+	return td, nil
+}
+
+// next cycles through the display modes, skipping the custom zone if none
+// was configured.
+func (td *timeDisplay) next() {
+	td.mode = (td.mode + 1) % (timeModeRelative + 1)
+	if td.mode == timeModeZone && td.zone == nil {
+		td.mode++
+	}
+}
+
+// name returns a short label for the current display mode.
+func (td *timeDisplay) name() string {
+	switch td.mode {
+	case timeModeUTC:
+		return "UTC"
+	case timeModeZone:
+		return td.zone.String()
+	case timeModeRelative:
+		return "relative"
+	default:
+		return "Local"
+	}
+}
+
+func (td *timeDisplay) format(ts time.Time, now time.Time) string {
+	switch td.mode {
+	case timeModeUTC:
+		return ts.UTC().Format(td.layout)
+	case timeModeZone:
+		return ts.In(td.zone).Format(td.layout)
+	case timeModeRelative:
+		return formatRelative(now.Sub(ts))
+	default:
+		return ts.Local().Format(td.layout)
+	}
+}
+
+// formatRelative formats the age of a log, e.g. "3.2s ago" or "5m ago".
+func formatRelative(d time.Duration) string {
+	if d < 0 {
+		return "in " + formatDuration(-d)
+	}
+	return formatDuration(d) + " ago"
+}
+
+// formatDelta formats the time elapsed between two consecutive logs, e.g.
+// "+120ms".
+func formatDelta(d time.Duration) string {
+	if d < 0 {
+		return "-" + formatDuration(-d)
+	}
+	return "+" + formatDuration(d)
+}
+
+// formatDuration formats a positive duration compactly, with at most one
+// decimal and a single unit.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Millisecond:
+		return fmt.Sprintf("%dµs", d.Microseconds())
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	case d < time.Minute:
+		return fmt.Sprintf("%.1fs", math.Floor(d.Seconds()*10)/10)
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeDisplayFormat(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %s", err)
+	}
+	ts := time.Date(2023, time.July, 24, 18, 34, 11, 241000000, time.UTC)
+
+	td, err := newTimeDisplay("UTC", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-07-24 18:34:11.241 UTC", td.format(ts, ts))
+
+	td, err = newTimeDisplay("Europe/Paris", time.TimeOnly)
+	assert.NoError(t, err)
+	assert.Equal(t, "20:34:11", td.format(ts, ts))
+	assert.Equal(t, paris.String(), td.name())
+
+	td.next()
+	assert.Equal(t, timeModeRelative, td.mode)
+	assert.Equal(t, "3.2s ago", td.format(ts, ts.Add(3250*time.Millisecond)))
+
+	td.next()
+	assert.Equal(t, timeModeLocal, td.mode)
+
+	_, err = newTimeDisplay("Nowhere/Special", "")
+	assert.Error(t, err)
+}
+
+func TestTimeDisplayNextSkipsZone(t *testing.T) {
+	td, err := newTimeDisplay("", "")
+	assert.NoError(t, err)
+	td.next()
+	assert.Equal(t, timeModeUTC, td.mode)
+	td.next()
+	assert.Equal(t, timeModeRelative, td.mode)
+}
+
+func TestFormatDuration(t *testing.T) {
+	type testCase struct {
+		in     time.Duration
+		expect string
+	}
+	testCases := []testCase{
+		{in: 250 * time.Microsecond, expect: "250µs"},
+		{in: 120 * time.Millisecond, expect: "120ms"},
+		{in: 3290 * time.Millisecond, expect: "3.2s"},
+		{in: 5*time.Minute + 30*time.Second, expect: "5m"},
+		{in: 2 * time.Hour, expect: "2h"},
+		{in: 72 * time.Hour, expect: "3d"},
+	}
+	for _, c := range testCases {
+		t.Run(c.in.String(), func(t *testing.T) {
+			assert.Equal(t, c.expect, formatDuration(c.in))
+		})
+	}
+	assert.Equal(t, "+120ms", formatDelta(120*time.Millisecond))
+	assert.Equal(t, "in 2h", formatRelative(-2*time.Hour))
+}